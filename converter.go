@@ -0,0 +1,95 @@
+package gocelot
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Converter validates the value of a typed param, eg. ':id|int', and converts
+// it. It returns false if the value doesn't belong to the type, in which case
+// the param doesn't match.
+type Converter func(value string) (interface{}, bool)
+
+// UUID represents a universally unique identifier matched by the 'uuid' type.
+type UUID [16]byte
+
+// String method returns the canonical form of the UUID, eg.
+// "123e4567-e89b-12d3-a456-426614174000".
+func (u UUID) String() string {
+	var text [36]byte
+	hex.Encode(text[0:8], u[0:4])
+	text[8] = '-'
+	hex.Encode(text[9:13], u[4:6])
+	text[13] = '-'
+	hex.Encode(text[14:18], u[6:8])
+	text[18] = '-'
+	hex.Encode(text[19:23], u[8:10])
+	text[23] = '-'
+	hex.Encode(text[24:], u[10:])
+	return string(text[:])
+}
+
+// builtinConverters holds the converters of the types which every router
+// knows:
+// int - a decimal integer, converted to int
+// uint - a decimal unsigned integer, converted to uint
+// uuid - a UUID in the canonical form, converted to UUID
+// slug - lower case letters and digits separated by single '-', eg. "my-post-1"
+// date - a date in the "2006-01-02" format, converted to time.Time
+var builtinConverters = map[string]Converter{
+	"int": convertInt,
+	"uint": convertUint,
+	"uuid": convertUUID,
+	"slug": convertSlug,
+	"date": convertDate,
+}
+
+// convertInt function converts the value to int.
+func convertInt(value string) (interface{}, bool) {
+	i, err := strconv.Atoi(value)
+	return i, err == nil
+}
+
+// convertUint function converts the value to uint.
+func convertUint(value string) (interface{}, bool) {
+	u, err := strconv.ParseUint(value, 10, strconv.IntSize)
+	return uint(u), err == nil
+}
+
+// convertUUID function converts the value in the canonical form to UUID.
+func convertUUID(value string) (interface{}, bool) {
+	var u UUID
+	if len(value) != 36 || value[8] != '-' || value[13] != '-' ||
+		value[18] != '-' || value[23] != '-' {
+
+		return u, false
+	}
+	digits := value[0:8] + value[9:13] + value[14:18] + value[19:23] +
+		value[24:]
+	if _, err := hex.Decode(u[:], []byte(digits)); err != nil {
+		return u, false
+	}
+	return u, true
+}
+
+// convertSlug function checks if the value is a slug and returns it unchanged.
+func convertSlug(value string) (interface{}, bool) {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '-' && i > 0 && i < len(value)-1 && value[i-1] != '-' {
+			continue
+		}
+		if ('a' > c || c > 'z') && ('0' > c || c > '9') {
+			return value, false
+		}
+	}
+	return value, value != ""
+}
+
+// convertDate function converts the value in the "2006-01-02" format to
+// time.Time.
+func convertDate(value string) (interface{}, bool) {
+	date, err := time.Parse("2006-01-02", value)
+	return date, err == nil
+}
@@ -0,0 +1,82 @@
+package gocelot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUUIDStringReturnsCanonicalForm(t *testing.T) {
+	u := UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56,
+		0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	if u.String() != "123e4567-e89b-12d3-a456-426614174000" {
+		t.Fail()
+	}
+}
+
+func TestConvertIntAcceptsOnlyIntegers(t *testing.T) {
+	if i, ok := convertInt("-42"); !ok || i != -42 {
+		t.Fail()
+	}
+	for _, value := range []string{"", "4a", "1.5", "99999999999999999999"} {
+		if _, ok := convertInt(value); ok {
+			t.Error(value)
+		}
+	}
+}
+
+func TestConvertUintAcceptsOnlyUnsignedIntegers(t *testing.T) {
+	if u, ok := convertUint("42"); !ok || u != uint(42) {
+		t.Fail()
+	}
+	for _, value := range []string{"", "-1", "+1", "4a"} {
+		if _, ok := convertUint(value); ok {
+			t.Error(value)
+		}
+	}
+}
+
+func TestConvertUUIDAcceptsOnlyCanonicalForm(t *testing.T) {
+	value := "123E4567-e89b-12d3-a456-426614174000"
+	if u, ok := convertUUID(value); !ok ||
+		u.(UUID).String() != "123e4567-e89b-12d3-a456-426614174000" {
+
+		t.Fail()
+	}
+	for _, value := range []string{"", "123e4567e89b12d3a456426614174000",
+		"123e4567-e89b-12d3-a456-42661417400g",
+		"123e4567-e89b-12d3-a456_426614174000"} {
+
+		if _, ok := convertUUID(value); ok {
+			t.Error(value)
+		}
+	}
+}
+
+func TestConvertSlugAcceptsOnlySlugs(t *testing.T) {
+	for _, value := range []string{"post", "my-post-1", "1"} {
+		if slug, ok := convertSlug(value); !ok || slug != value {
+			t.Error(value)
+		}
+	}
+	for _, value := range []string{"", "-post", "post-", "my--post", "Post",
+		"my_post"} {
+
+		if _, ok := convertSlug(value); ok {
+			t.Error(value)
+		}
+	}
+}
+
+func TestConvertDateAcceptsOnlyDates(t *testing.T) {
+	date, ok := convertDate("2020-02-29")
+	if !ok || !date.(time.Time).Equal(time.Date(2020, 2, 29, 0, 0, 0, 0,
+		time.UTC)) {
+
+		t.Fail()
+	}
+	for _, value := range []string{"", "2021-02-29", "2020-2-1", "20200201"} {
+		if _, ok := convertDate(value); ok {
+			t.Error(value)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gocelot
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpFormat is the format of the tree written by Router.DumpTree.
+type DumpFormat int
+
+const (
+	// DumpText is an indented text view of the tree, one node per line, with
+	// the next nodes of a node below it in their order.
+	DumpText DumpFormat = iota
+	// DumpDOT is a Graphviz DOT graph of the tree, eg. for the dot command.
+	DumpDOT
+)
+
+// DumpTree method writes the prefix tree of the router to w in the format,
+// so that it can be seen how the paths were split into nodes. Each node shows
+// its path, its kind, ie. static, param or catch-all, and the methods of its
+// handlers. The next nodes are written in the order they are matched in.
+// It returns an error if the format is unknown or writing to w fails.
+func (r *Router) DumpTree(w io.Writer, format DumpFormat) error {
+	switch format {
+	case DumpText:
+		return dumpText(w, r.tree.Load(), 0)
+	case DumpDOT:
+		if _, err := fmt.Fprintln(w, "digraph tree {"); err != nil {
+			return err
+		}
+		id := 0
+		if err := dumpDOT(w, r.tree.Load(), &id); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(w, "}")
+		return err
+	}
+	return fmt.Errorf("gocelot: unknown dump format %d", format)
+}
+
+// dotShapes holds the DOT shapes of the kinds of the nodes, see kind.
+var dotShapes = map[string]string{
+	"static": "box",
+	"param": "ellipse",
+	"catch-all": "doubleoctagon",
+}
+
+// dumpText function writes the node and all the nodes below it to w, each on
+// its own line, indented by its depth.
+// Eg.
+// "/users/" static
+//   ":id|int" param [GET, PUT]
+func dumpText(w io.Writer, n *node, depth int) error {
+	line := fmt.Sprintf("%s%q %s", strings.Repeat("  ", depth), n.path,
+		kind(n))
+	if n.handlers != nil {
+		line += " [" + strings.Join(n.handlers.methods(), ", ") + "]"
+	}
+	if _, err := fmt.Fprintln(w, line); err != nil {
+		return err
+	}
+	for _, next := range n.next {
+		if err := dumpText(w, next, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpDOT function writes the node and all the nodes below it to w as DOT
+// nodes and edges. The nodes are numbered by id in the order they are written
+// and the edges are labeled with the position of the next node.
+// Eg.
+// n0 [label="/users/" shape=box];
+// n1 [label=":id|int\n[GET, PUT]" shape=ellipse];
+// n0 -> n1 [label="0"];
+func dumpDOT(w io.Writer, n *node, id *int) error {
+	label := n.path
+	if n.handlers != nil {
+		label += "\n[" + strings.Join(n.handlers.methods(), ", ") + "]"
+	}
+	parent := *id
+	_, err := fmt.Fprintf(w, "\tn%d [label=%q shape=%s];\n", parent, label,
+		dotShapes[kind(n)])
+	if err != nil {
+		return err
+	}
+	for i, next := range n.next {
+		*id++
+		child := *id
+		if err := dumpDOT(w, next, id); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "\tn%d -> n%d [label=\"%d\"];\n", parent,
+			child, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kind function returns the kind of the node, ie. "static", "param" or
+// "catch-all".
+func kind(n *node) string {
+	switch {
+	case strings.HasPrefix(n.path, ":"):
+		return "param"
+	case strings.HasPrefix(n.path, "*"):
+		return "catch-all"
+	}
+	return "static"
+}
@@ -0,0 +1,76 @@
+package gocelot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// errorWriter fails every write.
+type errorWriter struct{}
+
+func (errorWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// dumpRouter function returns a router with static, param and catch-all nodes.
+func dumpRouter() *Router {
+	router := New()
+	router.Handle("GET", "/users", emptyHandler)
+	router.Handle("GET", "/users/:id|int", emptyHandler)
+	router.Handle("PUT", "/users/:id|int", emptyHandler)
+	router.Handle("GET", "/files/*path", emptyHandler)
+	return router
+}
+
+func TestDumpTreeWritesIndentedText(t *testing.T) {
+	var dump bytes.Buffer
+	err := dumpRouter().DumpTree(&dump, DumpText)
+	expected := `"/" static
+  "users" static [GET]
+    "/" static
+      ":id|int" param [GET, PUT]
+  "files/" static
+    "*path" catch-all [GET]
+`
+	if err != nil || dump.String() != expected {
+		t.Error(dump.String())
+	}
+}
+
+func TestDumpTreeWritesDOTGraph(t *testing.T) {
+	var dump bytes.Buffer
+	err := dumpRouter().DumpTree(&dump, DumpDOT)
+	expected := `digraph tree {
+	n0 [label="/" shape=box];
+	n1 [label="users\n[GET]" shape=box];
+	n2 [label="/" shape=box];
+	n3 [label=":id|int\n[GET, PUT]" shape=ellipse];
+	n2 -> n3 [label="0"];
+	n1 -> n2 [label="0"];
+	n0 -> n1 [label="0"];
+	n4 [label="files/" shape=box];
+	n5 [label="*path\n[GET]" shape=doubleoctagon];
+	n4 -> n5 [label="0"];
+	n0 -> n4 [label="1"];
+}
+`
+	if err != nil || dump.String() != expected {
+		t.Error(dump.String())
+	}
+}
+
+func TestDumpTreeWithUnknownFormatReturnsError(t *testing.T) {
+	var dump bytes.Buffer
+	if New().DumpTree(&dump, DumpFormat(-1)) == nil || dump.Len() != 0 {
+		t.Fail()
+	}
+}
+
+func TestDumpTreeReturnsErrorOfWriter(t *testing.T) {
+	for _, format := range []DumpFormat{DumpText, DumpDOT} {
+		if dumpRouter().DumpTree(errorWriter{}, format) == nil {
+			t.Error(format)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gocelot
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group adds routes to its router under a path prefix and wraps their handlers
+// with its middleware. The middleware is applied when the route is added, so
+// the group costs nothing when the requests are served.
+type Group struct {
+	router *Router
+	prefix string
+	middleware []Middleware
+}
+
+// Group method returns a group of routes added to r under the path prefix,
+// eg. "/admin", whose handlers are wrapped with the middleware. The first
+// middleware is the outermost one. The middleware of r wraps the middleware of
+// the group and the middleware of the routes is wrapped by it.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{r, strings.TrimSuffix(prefix, "/"), middleware}
+}
+
+// Group method returns a nested group under the path prefix appended to the
+// prefix of g. Its handlers are wrapped with the middleware of g first and then
+// with its own middleware.
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	nested := make([]Middleware, 0, len(g.middleware)+len(middleware))
+	nested = append(append(nested, g.middleware...), middleware...)
+	return &Group{g.router, g.prefix + strings.TrimSuffix(prefix, "/"), nested}
+}
+
+// Handle method adds the path appended to the prefix of the group and the
+// handler wrapped with the middleware for the method.
+// It returns the route, which can be named to build its URL, see Route.Name.
+// It panics if the route can't be added, see Router.TryHandle.
+func (g *Group) Handle(method, path string, handler http.Handler,
+	options ...Option) *Route {
+
+	route, err := g.addRoute(method, path, handler, options)
+	if err != nil {
+		panic(err)
+	}
+	return route
+}
+
+// TryHandle method adds the path appended to the prefix of the group and the
+// handler wrapped with the middleware for the method.
+// It returns a *RouteError if the route can't be added, see Router.TryHandle.
+func (g *Group) TryHandle(method, path string, handler http.Handler,
+	options ...Option) error {
+
+	_, err := g.addRoute(method, path, handler, options)
+	return err
+}
+
+// addRoute is a method which adds the route, see TryHandle, and returns it.
+func (g *Group) addRoute(method, path string, handler http.Handler,
+	options []Option) (*Route, error) {
+
+	routeOptions := make([]Option, 0, len(g.middleware)+len(options))
+	for _, middleware := range g.middleware {
+		routeOptions = append(routeOptions, middleware)
+	}
+	routeOptions = append(routeOptions, options...)
+	return g.router.addRoute(method, g.prefix+path, handler, routeOptions)
+}
+
+// HandleFunc method adds the path appended to the prefix of the group and the
+// handler wrapped with the middleware for the method.
+// It accepts func(http.ResponseWriter, *http.Request) as a handler
+func (g *Group) HandleFunc(method, path string,
+	handlerFunc func(http.ResponseWriter, *http.Request),
+	options ...Option) *Route {
+
+	return g.Handle(method, path, http.HandlerFunc(handlerFunc), options...)
+}
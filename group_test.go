@@ -0,0 +1,106 @@
+package gocelot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tagMiddleware function returns a middleware which appends the tag to the
+// response before calling the wrapped handler.
+func tagMiddleware(tag string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter,
+			request *http.Request) {
+
+			response.Write([]byte(tag))
+			next.ServeHTTP(response, request)
+		})
+	}
+}
+
+func TestGroupAddsRoutesUnderThePrefix(t *testing.T) {
+	router := New()
+	group := router.Group("/admin/")
+	group.Handle("GET", "/users/:id", emptyHandler)
+	group.HandleFunc("POST", "/users", emptyHandler.ServeHTTP)
+
+	if router.tree.Load().find("/admin/users/:id") == nil ||
+		router.tree.Load().find("/admin/users") == nil ||
+		router.tree.Load().find("/users") != nil {
+
+		t.Fail()
+	}
+}
+
+func TestGroupWrapsHandlersWithMiddlewareInOrder(t *testing.T) {
+	router := New()
+	group := router.Group("/admin", tagMiddleware("a"), tagMiddleware("b"))
+	group.HandleFunc("GET", "/users", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("h"))
+	})
+	router.HandleFunc("GET", "/users", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("h"))
+	})
+
+	request, _ := http.NewRequest("GET", "/admin/users", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "abh" {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/users", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "h" {
+		t.Fail()
+	}
+}
+
+func TestNestedGroupAddsPrefixAndMiddlewareOfParent(t *testing.T) {
+	router := New()
+	parent := router.Group("/api", tagMiddleware("a"))
+	nested := parent.Group("/v1", tagMiddleware("b"))
+	parent.Group("/v2", tagMiddleware("c"))
+	nested.HandleFunc("GET", "/users", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("h"))
+	})
+
+	request, _ := http.NewRequest("GET", "/api/v1/users", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "abh" {
+		t.Fail()
+	}
+}
+
+func TestGroupTryHandleReturnsErrorOfFullPath(t *testing.T) {
+	router := New()
+	group := router.Group("/admin")
+	group.Handle("GET", "/users", emptyHandler)
+	err := group.TryHandle("GET", "/users", emptyHandler)
+	var routeError *RouteError
+	if !errors.As(err, &routeError) || routeError.Path != "/admin/users" ||
+		!errors.Is(err, ErrDuplicateRoute) {
+
+		t.Fail()
+	}
+}
+
+func TestGroupHandlePanicsIfRouteCantBeAdded(t *testing.T) {
+	group := New().Group("/admin")
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	group.Handle("GET", "/:id/:", emptyHandler)
+}
@@ -15,21 +15,132 @@ func newHandlerArray() *handlerArray {
 	return &handlerArray{}
 }
 
-// get method returns a handler for the specified method if one exists.
+// get method returns a handler for the specified method if one exists,
+// regardless of its matchers. The handler without matchers is preferred.
 // It returns nil otherwise.
 func (ha *handlerArray) get(method string) http.Handler {
+	var handler http.Handler
 	for _, node := range ha.nodes {
-		if node.method == method {
+		if node.method == method && len(node.matchers) == 0 {
 			return node.handler
+		} else if node.method == method && handler == nil {
+			handler = node.handler
+		}
+	}
+	return handler
+}
+
+// match method returns a handler for the specified method whose matchers are
+// satisfied by the request. The handlers with matchers are tried in the order
+// they were added, the handlers without matchers are used if none of them
+// matches. Among the handlers producing media types, the one whose media type
+// is the most acceptable according to the Accept header of the request is
+// chosen, a handler producing no media types is used if none of them is
+// acceptable. It returns false if there are handlers for the method, but none
+// of them produces an acceptable media type.
+func (ha *handlerArray) match(method string,
+	request *http.Request) (http.Handler, bool) {
+
+	// the Accept header is only parsed if a handler produces media types
+	var ranges []mediaRange
+	parsed, found := false, false
+	for _, guarded := range []bool{true, false} {
+		var best, fallback http.Handler
+		bestQuality := 0.0
+		for _, node := range ha.nodes {
+			if node.method != method || (len(node.matchers) > 0) != guarded ||
+				(guarded && !node.matches(request)) {
+
+				continue
+			}
+			found = true
+			if node.produces == nil {
+				if fallback == nil {
+					fallback = node.handler
+				}
+				continue
+			}
+			if !parsed {
+				ranges, parsed = acceptRanges(request), true
+			}
+			if q := node.quality(ranges); q > bestQuality {
+				best, bestQuality = node.handler, q
+			}
+		}
+		if best != nil {
+			return best, true
+		} else if fallback != nil {
+			return fallback, true
+		}
+	}
+	return nil, !found
+}
+
+// add method adds the handler for the specified method and options if a
+// handler without matchers doesn't exist yet for the method and the media types
+// of the options or the handler has matchers. It returns false if the handler
+// wasn't added.
+func (ha *handlerArray) add(method string, handler http.Handler,
+	options ...Option) bool {
+
+	node := newHandlerNode(method, handler, options...)
+	if len(node.matchers) == 0 && ha.conflicts(method, node.produces) {
+		return false
+	}
+	ha.nodes = append(ha.nodes, node)
+	return true
+}
+
+// remove method removes all the handlers for the method. It returns false if
+// there are none.
+func (ha *handlerArray) remove(method string) bool {
+	nodes := ha.nodes[:0]
+	for _, node := range ha.nodes {
+		if node.method != method {
+			nodes = append(nodes, node)
 		}
 	}
-	return nil
+	for i := len(nodes); i < len(ha.nodes); i++ {
+		// let the removed handlers be garbage collected
+		ha.nodes[i] = nil
+	}
+	removed := len(nodes) < len(ha.nodes)
+	ha.nodes = nodes
+	return removed
 }
 
-// add method adds the handler for the specified method if one doesn't exist
-// yet.
-func (ha *handlerArray) add(method string, handler http.Handler) {
-	if ha.get(method) == nil {
-		ha.nodes = append(ha.nodes, newHandlerNode(method, handler))
+// conflicts method returns true if there already is a handler without matchers
+// for the method producing the same media types.
+func (ha *handlerArray) conflicts(method string, produces []mediaRange) bool {
+	for _, node := range ha.nodes {
+		if node.method == method && len(node.matchers) == 0 &&
+			equalMediaTypes(node.produces, produces) {
+
+			return true
+		}
+	}
+	return false
+}
+
+// methods method returns the methods of all the handlers in the order they were
+// added. Each method is returned once.
+func (ha *handlerArray) methods() []string {
+	methods := make([]string, 0, len(ha.nodes))
+	for i, node := range ha.nodes {
+		if ha.index(node.method) == i {
+			methods = append(methods, node.method)
+		}
+	}
+	return methods
+}
+
+// index method returns the index of the first handler for the method or -1 if
+// there is none.
+func (ha *handlerArray) index(method string) int {
+	for i, node := range ha.nodes {
+		if node.method == method {
+			return i
+		}
 	}
+	return -1
 }
@@ -1,6 +1,7 @@
 package gocelot
 
 import (
+	"net/http"
 	"testing"
 )
 
@@ -13,8 +14,8 @@ func TestNewHandlerArrayCreatesEmptyHandlerArray(t *testing.T) {
 
 func TestAddOfNewMethodAddsItToTheEndOfTheArray(t *testing.T) {
 	array := newHandlerArray()
-	array.add("GET", emptyHandler)
-	if array.nodes == nil || len(array.nodes) != 1 || array.nodes[0].method != "GET" || array.nodes[0].handler != emptyHandler {
+	added := array.add("GET", emptyHandler)
+	if !added || array.nodes == nil || len(array.nodes) != 1 || array.nodes[0].method != "GET" || array.nodes[0].handler != emptyHandler {
 		t.Fail()
 	}
 }
@@ -22,8 +23,8 @@ func TestAddOfNewMethodAddsItToTheEndOfTheArray(t *testing.T) {
 func TestAddOfExistingMethodDoesNothing(t *testing.T) {
 	array := newHandlerArray()
 	array.add("GET", emptyHandler)
-	array.add("GET", differentEmptyHandler)
-	if array.nodes == nil || len(array.nodes) != 1 || array.nodes[0].method != "GET" || array.nodes[0].handler != emptyHandler {
+	added := array.add("GET", differentEmptyHandler)
+	if added || array.nodes == nil || len(array.nodes) != 1 || array.nodes[0].method != "GET" || array.nodes[0].handler != emptyHandler {
 		t.Fail()
 	}
 }
@@ -53,3 +54,143 @@ func TestGetOfExistingMethodReturnsCorrespondingHandler(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestMethodsReturnsMethodsInTheOrderTheyWereAdded(t *testing.T) {
+	array := newHandlerArray()
+	array.add("POST", emptyHandler)
+	array.add("GET", emptyHandler)
+	methods := array.methods()
+	if len(methods) != 2 || methods[0] != "POST" || methods[1] != "GET" {
+		t.Fail()
+	}
+}
+
+func TestAddOfExistingMethodWithMatchersAddsIt(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler)
+	if !array.add("GET", differentEmptyHandler, Query("a")) ||
+		!array.add("GET", differentEmptyHandler, Query("a")) ||
+		len(array.nodes) != 3 || array.add("GET", differentEmptyHandler) {
+
+		t.Fail()
+	}
+}
+
+func TestGetPrefersHandlerWithoutMatchers(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", differentEmptyHandler, Query("a"))
+	if array.get("GET") != differentEmptyHandler {
+		t.Fail()
+	}
+	array.add("GET", emptyHandler)
+	if array.get("GET") != emptyHandler {
+		t.Fail()
+	}
+}
+
+func TestMatchTriesHandlersWithMatchersBeforeHandlerWithout(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler)
+	array.add("POST", differentEmptyHandler, Query("a"))
+	array.add("GET", differentEmptyHandler, Query("a"))
+	request, _ := http.NewRequest("GET", "/?a", nil)
+	handler, _ := array.match("GET", request)
+	if handler != differentEmptyHandler {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/?b", nil)
+	if handler, _ = array.match("GET", request); handler != emptyHandler {
+		t.Fail()
+	}
+}
+
+func TestMatchWithoutMatchingHandlerReturnsNil(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Query("a"))
+	request, _ := http.NewRequest("GET", "/", nil)
+	getHandler, getAcceptable := array.match("GET", request)
+	postHandler, postAcceptable := array.match("POST", request)
+	if getHandler != nil || postHandler != nil || !getAcceptable ||
+		!postAcceptable {
+
+		t.Fail()
+	}
+}
+
+func TestAddDetectsConflictOnlyForSameMediaTypes(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Produces("application/json"))
+	if !array.add("GET", emptyHandler) ||
+		!array.add("GET", emptyHandler, Produces("text/html")) ||
+		array.add("GET", emptyHandler, Produces("application/json")) {
+
+		t.Fail()
+	}
+}
+
+func TestMatchChoosesMostAcceptableMediaType(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Produces("application/json"))
+	array.add("GET", differentEmptyHandler, Produces("text/html"))
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "application/json;q=0.5, text/*")
+	handler, _ := array.match("GET", request)
+	if handler != differentEmptyHandler {
+		t.Fail()
+	}
+	request.Header.Set("Accept", "application/json, text/html;q=0.9")
+	if handler, _ = array.match("GET", request); handler != emptyHandler {
+		t.Fail()
+	}
+	request.Header.Del("Accept")
+	if handler, _ = array.match("GET", request); handler != emptyHandler {
+		t.Fail()
+	}
+}
+
+func TestMatchUsesHandlerWithoutMediaTypesIfNoneIsAcceptable(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Produces("application/json"))
+	array.add("GET", differentEmptyHandler)
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "text/html")
+	handler, acceptable := array.match("GET", request)
+	if handler != differentEmptyHandler || !acceptable {
+		t.Fail()
+	}
+}
+
+func TestMatchWithoutAcceptableMediaTypeReturnsFalse(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Produces("application/json"))
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "text/html, application/json;q=0")
+	if handler, acceptable := array.match("GET", request); handler != nil ||
+		acceptable {
+
+		t.Fail()
+	}
+}
+
+func TestRemoveRemovesAllHandlersOfMethod(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Query("a"))
+	array.add("POST", emptyHandler)
+	array.add("GET", emptyHandler)
+	if !array.remove("GET") || len(array.nodes) != 1 ||
+		array.nodes[0].method != "POST" || array.remove("GET") {
+
+		t.Fail()
+	}
+}
+
+func TestMethodsReturnsEachMethodOnce(t *testing.T) {
+	array := newHandlerArray()
+	array.add("GET", emptyHandler, Query("a"))
+	array.add("POST", emptyHandler)
+	array.add("GET", emptyHandler)
+	methods := array.methods()
+	if len(methods) != 2 || methods[0] != "GET" || methods[1] != "POST" {
+		t.Fail()
+	}
+}
@@ -5,12 +5,57 @@ import (
 )
 
 // handlerNode represents the method/handler relationship.
+// The handler is only used for the requests satisfying all the matchers.
+// If the handler produces some media types, it is only used for the requests
+// accepting them, see Produces.
 type handlerNode struct {
 	method string
 	handler http.Handler
+	matchers []Matcher
+	produces []mediaRange
 }
 
-// newHandlerNode returns a new handlerNode for the given method and handler.
-func newHandlerNode(method string, handler http.Handler) *handlerNode {
-	return &handlerNode{method, handler}
+// newHandlerNode returns a new handlerNode for the given method, handler and
+// the matchers and the media types of the options.
+func newHandlerNode(method string, handler http.Handler,
+	options ...Option) *handlerNode {
+
+	routeOptions := newRouteOptions(options)
+	return &handlerNode{method, handler, routeOptions.matchers,
+		routeOptions.produces}
+}
+
+// options method returns the options the handlerNode was created with.
+func (hn *handlerNode) options() []Option {
+	options := make([]Option, 0, len(hn.matchers)+1)
+	for _, matcher := range hn.matchers {
+		options = append(options, matcher)
+	}
+	if hn.produces != nil {
+		options = append(options, produces(hn.produces))
+	}
+	return options
+}
+
+// quality method returns the highest quality of the media types produced by
+// the handler according to the ranges of the Accept header, see quality.
+func (hn *handlerNode) quality(ranges []mediaRange) float64 {
+	best := 0.0
+	for _, produced := range hn.produces {
+		if q := quality(ranges, produced); q > best {
+			best = q
+		}
+	}
+	return best
+}
+
+// matches method returns true if the request satisfies all the matchers of
+// the handlerNode.
+func (hn *handlerNode) matches(request *http.Request) bool {
+	for _, matcher := range hn.matchers {
+		if !matcher(request) {
+			return false
+		}
+	}
+	return true
 }
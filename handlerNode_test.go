@@ -1,6 +1,7 @@
 package gocelot
 
 import (
+	"net/http"
 	"testing"
 )
 
@@ -11,3 +12,30 @@ func TestNewHandlerNodeCreatesHandlerNodeWithMethodAndHandler(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestMatchesReturnsTrueIfAllMatchersAreSatisfied(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/?a=1", nil)
+	node := newHandlerNode("GET", emptyHandler)
+	if !node.matches(request) {
+		t.Fail()
+	}
+	node = newHandlerNode("GET", emptyHandler, Query("a"), Query("b"))
+	if node.matches(request) {
+		t.Fail()
+	}
+	node = newHandlerNode("GET", emptyHandler, Query("a"), QueryValue("a", "1"))
+	if !node.matches(request) {
+		t.Fail()
+	}
+}
+
+func TestOptionsReturnsOptionsOfHandlerNode(t *testing.T) {
+	node := newHandlerNode("GET", emptyHandler, Query("a"),
+		Produces("application/json"))
+	copied := newHandlerNode("GET", emptyHandler, node.options()...)
+	if len(copied.matchers) != 1 ||
+		!equalMediaTypes(copied.produces, node.produces) {
+
+		t.Fail()
+	}
+}
@@ -0,0 +1,112 @@
+package gocelot
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Option customizes a route when it is added to the router, eg. a Matcher.
+type Option interface {
+	apply(options *routeOptions)
+}
+
+// routeOptions holds the customizations of a route, see Option.
+type routeOptions struct {
+	matchers []Matcher
+	produces []mediaRange
+	middleware []Middleware
+}
+
+// newRouteOptions function returns the customizations of the options.
+func newRouteOptions(options []Option) *routeOptions {
+	routeOptions := &routeOptions{}
+	for _, option := range options {
+		option.apply(routeOptions)
+	}
+	return routeOptions
+}
+
+// Matcher is a predicate which a request has to satisfy to be served by the
+// handler of a route. It is used as an Option of the route.
+type Matcher func(*http.Request) bool
+
+// apply method adds the matcher to the matchers of the route.
+func (m Matcher) apply(options *routeOptions) {
+	options.matchers = append(options.matchers, m)
+}
+
+// Header function returns a Matcher of the requests with the header key equal
+// to value.
+func Header(key, value string) Matcher {
+	return func(request *http.Request) bool {
+		for _, headerValue := range request.Header.Values(key) {
+			if headerValue == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HeaderRegexp function returns a Matcher of the requests with the header key
+// matching the regular expression. It panics if the expression is malformed.
+func HeaderRegexp(key, expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return func(request *http.Request) bool {
+		for _, headerValue := range request.Header.Values(key) {
+			if re.MatchString(headerValue) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Query function returns a Matcher of the requests with the query param key,
+// whatever its value.
+func Query(key string) Matcher {
+	return func(request *http.Request) bool {
+		return request.URL.Query().Has(key)
+	}
+}
+
+// QueryValue function returns a Matcher of the requests with the query param
+// key equal to value.
+func QueryValue(key, value string) Matcher {
+	return func(request *http.Request) bool {
+		for _, queryValue := range request.URL.Query()[key] {
+			if queryValue == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Scheme function returns a Matcher of the requests with the scheme, ie.
+// "http" or "https", compared ignoring the case. The scheme of the requests
+// received by the server is "https" if they came over TLS.
+func Scheme(scheme string) Matcher {
+	return func(request *http.Request) bool {
+		requestScheme := request.URL.Scheme
+		if requestScheme == "" && request.TLS != nil {
+			requestScheme = "https"
+		} else if requestScheme == "" {
+			requestScheme = "http"
+		}
+		return strings.EqualFold(requestScheme, scheme)
+	}
+}
+
+// ContentType function returns a Matcher of the requests with the media type
+// of the Content-Type header, eg. "application/json", compared ignoring the
+// case and the parameters of the header.
+func ContentType(mediaType string) Matcher {
+	return func(request *http.Request) bool {
+		contentType := request.Header.Get("Content-Type")
+		requestType, _, err := mime.ParseMediaType(contentType)
+		return err == nil && strings.EqualFold(requestType, mediaType)
+	}
+}
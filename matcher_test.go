@@ -0,0 +1,82 @@
+package gocelot
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+)
+
+func TestNewRouteOptionsAppliesAllOptions(t *testing.T) {
+	options := newRouteOptions([]Option{Header("a", "b"), Query("c")})
+	if len(options.matchers) != 2 {
+		t.Fail()
+	}
+}
+
+func TestHeaderMatchesAnyValueOfTheHeader(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Add("X-API-Version", "1")
+	request.Header.Add("X-API-Version", "2")
+	if !Header("X-Api-Version", "2")(request) ||
+		Header("X-API-Version", "3")(request) ||
+		Header("Other", "2")(request) {
+
+		t.Fail()
+	}
+}
+
+func TestHeaderRegexpMatchesAnyValueOfTheHeader(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "application/vnd.api+json")
+	if !HeaderRegexp("Accept", `\+json$`)(request) ||
+		HeaderRegexp("Accept", `\+xml$`)(request) {
+
+		t.Fail()
+	}
+}
+
+func TestQueryMatchesPresentParamWhateverItsValue(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/?format=&other=1", nil)
+	if !Query("format")(request) || !Query("other")(request) ||
+		Query("missing")(request) {
+
+		t.Fail()
+	}
+}
+
+func TestQueryValueMatchesAnyValueOfTheParam(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/?format=xml&format=json", nil)
+	if !QueryValue("format", "json")(request) ||
+		QueryValue("format", "csv")(request) {
+
+		t.Fail()
+	}
+}
+
+func TestSchemeMatchesSchemeOfURLOrTLS(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	if !Scheme("http")(request) || Scheme("https")(request) {
+		t.Fail()
+	}
+	request.TLS = &tls.ConnectionState{}
+	if !Scheme("HTTPS")(request) {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "https://example.com/", nil)
+	if !Scheme("https")(request) {
+		t.Fail()
+	}
+}
+
+func TestContentTypeMatchesMediaTypeIgnoringParams(t *testing.T) {
+	request, _ := http.NewRequest("POST", "/", nil)
+	if ContentType("application/json")(request) {
+		t.Fail()
+	}
+	request.Header.Set("Content-Type", "Application/JSON; charset=utf-8")
+	if !ContentType("application/json")(request) ||
+		ContentType("text/plain")(request) {
+
+		t.Fail()
+	}
+}
@@ -0,0 +1,24 @@
+package gocelot
+
+import (
+	"net/http"
+)
+
+// Middleware wraps a handler with another one, eg. to check the authentication
+// before the request is passed to the wrapped handler. It is used as an Option
+// of a route to wrap only the handler of the route, see also Router.Use.
+type Middleware func(http.Handler) http.Handler
+
+// apply method adds the middleware to the middleware of the route.
+func (m Middleware) apply(options *routeOptions) {
+	options.middleware = append(options.middleware, m)
+}
+
+// wrap function returns the handler wrapped with the middleware, the first
+// middleware being the outermost one.
+func wrap(handler http.Handler, middleware []Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
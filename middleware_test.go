@@ -0,0 +1,30 @@
+package gocelot
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrapMakesFirstMiddlewareOutermost(t *testing.T) {
+	handler := wrap(emptyHandler, []Middleware{tagMiddleware("a"),
+		tagMiddleware("b")})
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, nil)
+	if response.Body.String() != "ab" {
+		t.Fail()
+	}
+}
+
+func TestWrapWithoutMiddlewareReturnsHandler(t *testing.T) {
+	if wrap(emptyHandler, nil) != emptyHandler {
+		t.Fail()
+	}
+}
+
+func TestMiddlewareAddsItselfToRouteOptions(t *testing.T) {
+	options := newRouteOptions([]Option{tagMiddleware("a"),
+		Query("a"), tagMiddleware("b")})
+	if len(options.middleware) != 2 || len(options.matchers) != 1 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,177 @@
+package gocelot
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// mediaRange represents a single media range of the Accept header, eg.
+// "text/*;q=0.5", with its quality.
+type mediaRange struct {
+	mediaType string
+	subtype string
+	params []string
+	quality float64
+}
+
+// parseAccept function returns the media ranges of the Accept header. The
+// malformed ranges are skipped. The parameters of the ranges are kept in the
+// "key=value" form, with the key in lower case. Like the quality, the accept
+// extensions after it are not kept in params.
+// Eg.
+// parseAccept("text/html;level=1, */*;q=0.1")
+// returns {"text", "html", {"level=1"}, 1}, {"*", "*", nil, 0.1}
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, element := range strings.Split(header, ",") {
+		parts := strings.Split(element, ";")
+		mediaType, subtype, ok := splitMediaType(parts[0])
+		if !ok {
+			continue
+		}
+		mediaRange := mediaRange{mediaType, subtype, nil, 1}
+		for _, param := range parts[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "q" {
+				quality, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+				if err != nil || quality < 0 || quality > 1 {
+					quality = 1
+				}
+				mediaRange.quality = quality
+				break
+			}
+			mediaRange.params = append(mediaRange.params,
+				key+"="+strings.Trim(strings.TrimSpace(value), `"`))
+		}
+		ranges = append(ranges, mediaRange)
+	}
+	return ranges
+}
+
+// acceptRanges function returns the media ranges of all the Accept headers of
+// the request or nil if it has none.
+func acceptRanges(request *http.Request) []mediaRange {
+	accept := request.Header.Values("Accept")
+	if len(accept) == 0 {
+		return nil
+	}
+	return parseAccept(strings.Join(accept, ","))
+}
+
+// splitMediaType function returns the type and the subtype of the media type
+// in lower case. It returns false if the media type is malformed.
+func splitMediaType(mediaType string) (string, string, bool) {
+	mediaType, subtype, ok := strings.Cut(strings.TrimSpace(mediaType), "/")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	subtype = strings.ToLower(strings.TrimSpace(subtype))
+	if !ok || mediaType == "" || subtype == "" ||
+		mediaType == "*" && subtype != "*" {
+
+		return "", "", false
+	}
+	return mediaType, subtype, true
+}
+
+// specificity method returns how specific the range is for the media type or
+// -1 if the range doesn't match it. The ranges with a type and a subtype are
+// more specific than the ones with a type only and even more than "*/*". The
+// ranges with more parameters are more specific too.
+func (mr mediaRange) specificity(produced mediaRange) int {
+	if mr.mediaType != "*" && mr.mediaType != produced.mediaType ||
+		mr.subtype != "*" && mr.subtype != produced.subtype {
+
+		return -1
+	}
+	for _, param := range mr.params {
+		if !contains(produced.params, param) {
+			return -1
+		}
+	}
+	specificity := len(mr.params)
+	if mr.mediaType != "*" {
+		specificity += 100
+	}
+	if mr.subtype != "*" {
+		specificity += 100
+	}
+	return specificity
+}
+
+// quality function returns the quality of the produced media type according
+// to the ranges of the Accept header, ie. the quality of the most specific
+// range matching the media type or 0 if there is none. If there are no ranges,
+// any media type is acceptable.
+func quality(ranges []mediaRange, produced mediaRange) float64 {
+	if ranges == nil {
+		return 1
+	}
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range ranges {
+		if s := mediaRange.specificity(produced); s > specificity {
+			quality, specificity = mediaRange.quality, s
+		}
+	}
+	return quality
+}
+
+// contains function returns true if the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// produces is an Option of a route with the media types produced by its
+// handler, see Produces.
+type produces []mediaRange
+
+// apply method adds the media types to the media types of the route.
+func (p produces) apply(options *routeOptions) {
+	options.produces = append(options.produces, p...)
+}
+
+// Produces function returns an Option of a route whose handler produces the
+// media types, eg. "application/json". The handlers of the same path/method
+// producing different media types are chosen by the Accept header of the
+// request. If none of them is acceptable, the other routes matching the path
+// are tried before the request is answered with Router.NotAcceptable.
+// It panics if any of the media types is malformed or has a wildcard.
+func Produces(mediaTypes ...string) Option {
+	var p produces
+	for _, mediaType := range mediaTypes {
+		ranges := parseAccept(mediaType)
+		if len(ranges) != 1 || ranges[0].mediaType == "*" ||
+			ranges[0].subtype == "*" || strings.Contains(mediaType, ",") {
+
+			panic("gocelot: malformed media type " + mediaType)
+		}
+		p = append(p, ranges[0])
+	}
+	return p
+}
+
+// equalMediaTypes function returns true if a and b have the same media types
+// in the same order.
+func equalMediaTypes(a, b []mediaRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].mediaType != b[i].mediaType || a[i].subtype != b[i].subtype ||
+			len(a[i].params) != len(b[i].params) {
+
+			return false
+		}
+		for j := range a[i].params {
+			if a[i].params[j] != b[i].params[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
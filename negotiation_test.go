@@ -0,0 +1,118 @@
+package gocelot
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseAcceptReturnsRangesWithParamsAndQuality(t *testing.T) {
+	ranges := parseAccept(`Text/HTML;Level="1", */*;q=0.1;ext=a, bad, text/*`)
+	if len(ranges) != 3 || ranges[0].mediaType != "text" ||
+		ranges[0].subtype != "html" || len(ranges[0].params) != 1 ||
+		ranges[0].params[0] != "level=1" || ranges[0].quality != 1 ||
+		ranges[1].mediaType != "*" || ranges[1].params != nil ||
+		ranges[1].quality != 0.1 || ranges[2].subtype != "*" {
+
+		t.Fail()
+	}
+}
+
+func TestParseAcceptSkipsMalformedRanges(t *testing.T) {
+	ranges := parseAccept("text, /html, */html, text/")
+	if len(ranges) != 0 {
+		t.Fail()
+	}
+}
+
+func TestParseAcceptUsesQualityOneIfQualityIsInvalid(t *testing.T) {
+	ranges := parseAccept("text/html;q=2, text/plain;q=x")
+	if len(ranges) != 2 || ranges[0].quality != 1 || ranges[1].quality != 1 {
+		t.Fail()
+	}
+}
+
+func TestSpecificityPrefersConcreteTypesAndParams(t *testing.T) {
+	produced := parseAccept("text/html;level=1")[0]
+	ranges := parseAccept("*/*, text/*, text/html, text/html;level=1")
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].specificity(produced) <=
+			ranges[i-1].specificity(produced) {
+
+			t.Fail()
+		}
+	}
+	if parseAccept("text/plain")[0].specificity(produced) != -1 ||
+		parseAccept("text/html;level=2")[0].specificity(produced) != -1 {
+
+		t.Fail()
+	}
+}
+
+func TestQualityUsesMostSpecificMatchingRange(t *testing.T) {
+	ranges := parseAccept("text/*;q=0.5, text/html;q=0.8, */*;q=0.1")
+	if quality(ranges, parseAccept("text/html")[0]) != 0.8 ||
+		quality(ranges, parseAccept("text/plain")[0]) != 0.5 ||
+		quality(ranges, parseAccept("image/png")[0]) != 0.1 {
+
+		t.Fail()
+	}
+	ranges = parseAccept("text/html")
+	if quality(ranges, parseAccept("image/png")[0]) != 0 {
+		t.Fail()
+	}
+}
+
+func TestQualityWithoutRangesAcceptsAnyMediaType(t *testing.T) {
+	if quality(nil, parseAccept("image/png")[0]) != 1 {
+		t.Fail()
+	}
+}
+
+func TestProducesAddsMediaTypesToRouteOptions(t *testing.T) {
+	options := newRouteOptions([]Option{Produces("application/json"),
+		Produces("Text/HTML", "text/plain;charset=utf-8")})
+	if len(options.produces) != 3 || options.produces[1].subtype != "html" ||
+		options.produces[2].params[0] != "charset=utf-8" {
+
+		t.Fail()
+	}
+}
+
+func TestProducesPanicsOnMalformedOrWildcardMediaType(t *testing.T) {
+	for _, mediaType := range []string{"json", "text/*", "*/*",
+		"text/html, text/plain"} {
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error(mediaType)
+				}
+			}()
+			Produces(mediaType)
+		}()
+	}
+}
+
+func TestEqualMediaTypesComparesTypesAndParams(t *testing.T) {
+	a := parseAccept("text/html;level=1, application/json")
+	if !equalMediaTypes(a, parseAccept("text/html;level=1,application/json")) ||
+		equalMediaTypes(a, parseAccept("text/html, application/json")) ||
+		equalMediaTypes(a, parseAccept("text/html;level=1")) ||
+		!equalMediaTypes(nil, nil) {
+
+		t.Fail()
+	}
+}
+
+func TestAcceptRangesJoinsAcceptHeaders(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	if acceptRanges(request) != nil {
+		t.Fail()
+	}
+	request.Header.Add("Accept", "text/html")
+	request.Header.Add("Accept", "application/json;q=0.5")
+	ranges := acceptRanges(request)
+	if len(ranges) != 2 || ranges[1].quality != 0.5 {
+		t.Fail()
+	}
+}
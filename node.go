@@ -1,17 +1,23 @@
 package gocelot
 
 import (
+	"fmt"
 	"net/http"
-	"net/url"
+	"regexp"
+	"strings"
 )
 
 // node represents a prefix tree node and is used for routing.
 // It has a path of the current node, a list of next nodes and a handlerArray
-// for the path.
+// for the path. A param node with a constraint(':name<regexp>') also has the
+// compiled constraint and a typed param node(':name|type') has the converter of
+// the type.
 type node struct {
 	path string
 	next []*node
 	handlers *handlerArray
+	constraint *regexp.Regexp
+	converter Converter
 }
 
 // newNode is a function which returns a new empty node.
@@ -19,65 +25,172 @@ func newNode() *node {
 	return &node{}
 }
 
-/*
-debugging nodes
-
-var nodes []*node
-
-func newNode() *node {
-	node := &node{}
-	nodes = append(nodes, node)
-	return node
-}
-
-func Print() {
-	for _, node := range nodes {
-		log.Print(node.path)
-	}
-}
-*/
-
 // nodeSeqFromPath is a function which returns the first and the last node of
 // the sequence.
 // If the path doesn't contain params(':'), the first and the last nodes are
 // the same.
-// All the params(':') are stored in seperate nodes.
+// All the params(':') and catch-alls('*') are stored in seperate nodes, see
+// tokenEnd.
+// The constraints of the params are compiled and the types are looked up in
+// converters, so the path should be valid, see validatePath.
 // Eg.
 // nodeSeqFromPath('/path/:param/end/')
 // returns node('/path/'), node('/end/')
 // and the sequence is node('/path') -> node(':param') -> node('/end/')
-func nodeSeq(path string) (*node, *node) {
+// nodeSeqFromPath('/files/:name.:ext')
+// returns node('/files/'), node(':ext')
+// and the sequence is
+// node('/files/') -> node(':name') -> node('.') -> node(':ext')
+func nodeSeq(path string, converters map[string]Converter) (*node, *node) {
 	first := newNode()
 	last := first
-	start, isParam := 0, false
-	extendSeq := func(end int) {
-		if start != end {
-			if last.path == "" {
-				last.path = path[start:end]
-			} else {
-				next := newNode()
-				next.path = path[start:end]
-				last.next = []*node{next}
-				last = next
-			}
+	for start, end := 0, 0; start < len(path); start = end {
+		if path[start] == ':' || path[start] == '*' {
+			end = start + tokenEnd(path[start:])
+		} else if end = strings.IndexAny(path[start:], ":*"); end < 0 {
+			end = len(path)
+		} else {
+			end += start
 		}
-		start = end
-		isParam = !isParam
-	}
-	for end, letter := range path {
-		switch isParam {
-		case false:
-			if letter == ':' {
-				extendSeq(end)
+		if last.path != "" {
+			next := newNode()
+			last.next = []*node{next}
+			last = next
+		}
+		last.path = path[start:end]
+		_, constraint := splitParam(last.path)
+		if constraint != "" && constraint[0] == '<' {
+			last.constraint = regexp.MustCompile(anchor(constraint))
+		} else if constraint != "" {
+			last.converter = converters[constraint[1:]]
+		}
+	}
+	return first, last
+}
+
+// tokenEnd function returns the length of the param(':') or catch-all('*')
+// token at the start of the path. The token consists of ':' or '*', the name
+// made of letters, digits and '_' and an optional constraint, ie. a regular
+// expression in '<' and '>' or a type after '|'. Anything after the token is
+// static text, so the params can be embedded in the segments of the path.
+// Eg.
+// tokenEnd(':name.:ext')
+// returns 5
+// tokenEnd(':id<[0-9]{2}>/end')
+// returns 13
+func tokenEnd(path string) int {
+	end := 1
+	for end < len(path) && isNameChar(path[end]) {
+		end++
+	}
+	if end < len(path) && path[end] == '<' {
+		// the constraint ends at the matching '>', it can't contain '/'
+		depth := 0
+		for ; end < len(path) && path[end] != '/'; end++ {
+			if path[end] == '<' {
+				depth++
+			} else if path[end] == '>' {
+				depth--
 			}
-		case true:
-			if letter == '/' {
-				extendSeq(end)
+			if depth == 0 {
+				return end + 1
 			}
 		}
+	} else if end < len(path) && path[end] == '|' {
+		end++
+		for end < len(path) && isNameChar(path[end]) {
+			end++
+		}
 	}
-	extendSeq(len(path))
-	return first, last
+	return end
+}
+
+// isNameChar function returns true if c can be used in the name of a param or
+// a type, ie. it is an ASCII letter, a digit or '_'.
+func isNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || c == '_'
+}
+
+// validatePath is a function which returns an error if the path is malformed.
+// A valid path starts with '/' and all its params(':') and catch-alls('*') have
+// non-empty names, see tokenEnd. A catch-all has to be the whole last segment
+// of the path. A param can be followed by a constraint, ie. a regular
+// expression in '<' and '>' which doesn't contain '/' or a type after '|' which
+// has a converter in converters. A param has to be separated from the next
+// param by static text, which can't start with '<' or '|'. The path can't
+// contain '[', ']' or '?' outside the constraints.
+func validatePath(path string, converters map[string]Converter) error {
+	if path == "" || path[0] != '/' {
+		return fmt.Errorf("%w: it has to start with '/'", ErrInvalidPath)
+	}
+	for start := 0; start < len(path); start++ {
+		if strings.IndexByte("[]?", path[start]) >= 0 {
+			// the optional parts are expanded before, see expandPath
+			return fmt.Errorf("%w: unexpected %c at %d", ErrInvalidPath,
+				path[start], start)
+		}
+		if path[start] != ':' && path[start] != '*' {
+			continue
+		}
+		end := start + tokenEnd(path[start:])
+		name, constraint := splitParam(path[start:end])
+		if name == "" {
+			return fmt.Errorf("%w: empty name of %c at %d", ErrInvalidPath,
+				path[start], start)
+		}
+		if constraint != "" && constraint[0] == '<' &&
+			(len(constraint) < 3 || constraint[len(constraint)-1] != '>') ||
+			end < len(path) && strings.IndexByte(":*<|", path[end]) >= 0 {
+
+			return fmt.Errorf("%w: malformed segment %s", ErrInvalidPath,
+				path[start:start+indexOf(path[start:], '/')])
+		}
+		if constraint != "" && path[start] == '*' {
+			return fmt.Errorf("%w: catch-all %s can't have a constraint",
+				ErrInvalidPath, path[start:end])
+		}
+		if constraint != "" && constraint[0] == '<' {
+			if _, err := regexp.Compile(anchor(constraint)); err != nil {
+				return fmt.Errorf("%w: constraint of %s: %v", ErrInvalidPath,
+					path[start:end], err)
+			}
+		} else if constraint != "" && converters[constraint[1:]] == nil {
+			return fmt.Errorf("%w: unknown type of %s", ErrInvalidPath,
+				path[start:end])
+		}
+		if path[start] == '*' && (end != len(path) || path[start-1] != '/') {
+			return fmt.Errorf("%w: catch-all %s has to be the last segment",
+				ErrInvalidPath, path[start:end])
+		}
+		start = end - 1
+	}
+	return nil
+}
+
+// splitParam function returns the name and the constraint of the param(':') or
+// the catch-all('*') token. The constraint is either a regular expression in
+// '<' and '>' or a type after '|'. It is empty if the token doesn't have one.
+// Eg.
+// splitParam(':id<[0-9]+>')
+// returns 'id', '<[0-9]+>'
+// splitParam(':id|int')
+// returns 'id', '|int'
+func splitParam(token string) (string, string) {
+	if token == "" || token[0] != ':' && token[0] != '*' {
+		return "", ""
+	}
+	end := 1
+	for end < len(token) && token[end] != '<' && token[end] != '|' {
+		end++
+	}
+	return token[1:end], token[end:]
+}
+
+// anchor function returns the regular expression which matches only the whole
+// string matched by the constraint in '<' and '>'.
+func anchor(constraint string) string {
+	return "^(?:" + constraint[1:len(constraint)-1] + ")$"
 }
 
 // min is a helper function which returns the minimum of two intergers.
@@ -118,27 +231,36 @@ func lcp(a, b string) int {
 // NOT
 // node('/path/') -> node(':param') -> node('1/end/')
 // node('/path/') -> node(':param') -> node('2/finish/')
-func (n *node) add(path string) *node {
+// Params with different constraints are stored in different nodes too.
+// The path should be valid, see validatePath, and converters are used to look
+// up the types of the new nodes.
+// add returns an error if a different param or catch-all with the same
+// constraint is already stored at the same position as one from the path.
+func (n *node) add(path string,
+	converters map[string]Converter) (*node, error) {
+
 	diff := lcp(n.path, path)
 	if diff == len(n.path) && diff == len(path) {
 		// the paths are equal, no new nodes were created
-		return n
+		return n, nil
 	}
-	if n.path[0] == ':' {
-		// the node.path is a param
-		if diff == len(path) || path[diff] != '/' {
+	if n.path[0] == ':' || n.path[0] == '*' {
+		// the node.path is a param or a catch-all
+		if path[:tokenEnd(path)] != n.path {
 			// the params are different, have to rollback
-			return nil
+			return nil, fmt.Errorf("%w %s and %s", ErrParamConflict,
+				path[:tokenEnd(path)], n.path)
 		}
 	}
 	if diff == len(n.path) {
 		// n.path matches exactly, have to search next nodes
 		for _, next := range n.next {
-			if next.path[0] == path[diff] {
-				node := next.add(path[diff:])
-				if node != nil {
-					return node
-				}
+			if next.path[0] == path[diff] && (next.path[0] != ':' ||
+				sameConstraint(next.path, path[diff:])) {
+
+				// there is at most one next node starting with the same letter
+				// or one param with the same constraint
+				return next.add(path[diff:], converters)
 			}
 		}
 	} else {
@@ -154,13 +276,164 @@ func (n *node) add(path string) *node {
 
 		if diff == len(path) {
 			// path matches the new n.path exactly
-			return n
+			return n, nil
 		}
 	}
 	// path has to be split at diff
-	first, last := nodeSeq(path[diff:])
-	n.next = append(n.next, first)
-	return last
+	first, last := nodeSeq(path[diff:], converters)
+	n.insert(first)
+	return last, nil
+}
+
+// sameConstraint function returns true if the param token and the first
+// param token of the path have the same constraint.
+func sameConstraint(token, path string) bool {
+	_, a := splitParam(token)
+	_, b := splitParam(path[:tokenEnd(path)])
+	return a == b
+}
+
+// insert is a method which adds next to the next nodes of the node.
+// The next nodes are kept in the order of their specificity so that the more
+// specific ones are tried first: static nodes, constrained or typed params,
+// params without a constraint and catch-alls. The nodes of the same
+// specificity are kept in the order they were added.
+func (n *node) insert(next *node) {
+	i := len(n.next)
+	for i > 0 && rank(n.next[i-1]) > rank(next) {
+		i--
+	}
+	n.next = append(n.next, nil)
+	copy(n.next[i+1:], n.next[i:])
+	n.next[i] = next
+}
+
+// rank function returns the specificity of the node, the lower the more
+// specific, see insert.
+func rank(n *node) int {
+	switch n.path[0] {
+	case '*':
+		return 3
+	case ':':
+		if _, constraint := splitParam(n.path); constraint == "" {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// find is a method which returns the node holding exactly the path or nil if
+// there is no such node. Unlike add, it never changes the tree.
+func (n *node) find(path string) *node {
+	if len(path) < len(n.path) || n.path != path[:len(n.path)] {
+		return nil
+	}
+	if len(path) == len(n.path) {
+		return n
+	}
+	for _, next := range n.next {
+		if node := next.find(path[len(n.path):]); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// walk is a method which calls fn for the node and all the nodes below it which
+// have handlers. fn receives the full path of the node, ie. prefix followed by
+// the paths of all the nodes on the way down.
+func (n *node) walk(prefix string, fn func(path string, n *node)) {
+	path := prefix + n.path
+	if n.handlers != nil {
+		fn(path, n)
+	}
+	for _, next := range n.next {
+		next.walk(path, fn)
+	}
+}
+
+// clone is a method which returns a deep copy of the node and all the nodes
+// below it, with their own handlerArrays, so that the copy can be changed
+// without changing n.
+func (n *node) clone() *node {
+	copied := *n
+	if n.handlers != nil {
+		copied.handlers = &handlerArray{append([]*handlerNode(nil),
+			n.handlers.nodes...)}
+	}
+	copied.next = make([]*node, len(n.next))
+	for i, next := range n.next {
+		copied.next[i] = next.clone()
+	}
+	return &copied
+}
+
+// compact is a method which removes the nodes below n left without handlers
+// and next nodes, eg. after their handlers were removed. A static node without
+// handlers and with a single static next node is merged with it, like if the
+// path of the next node was added without splitting. n itself is kept.
+func (n *node) compact() {
+	if n.handlers != nil && len(n.handlers.nodes) == 0 {
+		n.handlers = nil
+	}
+	nexts := n.next[:0]
+	for _, next := range n.next {
+		next.compact()
+		if next.handlers == nil && len(next.next) == 0 {
+			continue
+		}
+		if next.handlers == nil && len(next.next) == 1 && rank(next) == 0 &&
+			rank(next.next[0]) == 0 {
+
+			// next and its only next node are static, merge them
+			merged := next.next[0]
+			next.path += merged.path
+			next.next, next.handlers = merged.next, merged.handlers
+		}
+		nexts = append(nexts, next)
+	}
+	for i := len(nexts); i < len(n.next); i++ {
+		n.next[i] = nil
+	}
+	n.next = nexts
+}
+
+// countParams function returns the number of params(':') and catch-alls('*')
+// in the path.
+func countParams(path string) int {
+	count := 0
+	for start := 0; start < len(path); start++ {
+		if path[start] == ':' || path[start] == '*' {
+			count++
+			// the constraint of the param can contain ':' or '*' too
+			start += tokenEnd(path[start:]) - 1
+		}
+	}
+	return count
+}
+
+// equal function returns true if a and b are equal. If fold is true, the ASCII
+// letters are compared ignoring their case.
+func equal(a, b string, fold bool) bool {
+	if !fold || len(a) != len(b) {
+		return a == b
+	}
+	for i := 0; i < len(a); i++ {
+		if toLower(a[i]) != toLower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// toLower function returns the lower case of the ASCII letter c or c itself if
+// it is not an ASCII upper case letter.
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
 }
 
 // indexOf function returns index of the next occurence of c in s
@@ -174,93 +447,214 @@ func indexOf(s string, c rune) int {
 	return len(s)
 }
 
-/*
-alternative params return pattern which uses one alloc per request with params
+// addParam function adds key/value and the typed value at the end of params.
+// It doesn't allocate if params have enough capacity.
+func addParam(params *Params, key, value string, typed interface{}) {
+	*params = append(*params, Param{key, value, typed})
+}
+
+// get is a method which returns a http.Handler for the specified path/method
+// matching the request if one exists, see handlerArray.match.
+// If more than one node matches the path, the first one with a handler for the
+// method matching the request is used, see insert for the order in which they
+// are tried. If the request is nil, any handler for the method is used.
+// It also returns the handlers of the node or, if no handler is found, of the
+// first node with a handler for the method or of the first node matching the
+// path. It returns nil if the path doesn't exist.
+// The params matched on the way to the handler are added to params in the
+// order they appear in the path. If no handler is found, params are left
+// unchanged.
+// If fold is true, the static parts of the path are matched ignoring the case
+// of ASCII letters.
+func (n *node) get(path, method string, request *http.Request,
+	params *Params, fold bool) (http.Handler, *handlerArray) {
 
-func addParam(paramList []string, paramCount int, key, value string) []string {
-	paramPos := (paramCount + 1) * 2
-	if paramList == nil {
-		paramList = make([]string, paramPos)
+	handlers := n.lookup(path, method, request, params, fold)
+	if handlers != nil && request == nil {
+		return handlers.get(method), handlers
+	} else if handlers != nil {
+		handler, _ := handlers.match(method, request)
+		return handler, handlers
 	}
-	paramList[paramPos - 2] = key
-	paramList[paramPos - 1] = value
-	return paramList
+	count := len(*params)
+	if request != nil {
+		// the handlers for the method may not match the request
+		handlers = n.lookup(path, method, nil, params, fold)
+	}
+	if handlers == nil {
+		// no node matching the path has a handler for the method
+		handlers = n.lookup(path, "", nil, params, fold)
+	}
+	*params = (*params)[:count]
+	return nil, handlers
 }
-*/
-
-// addParam function adds key/value to request.Form if handler exists.
-// It creates request.Form if necessary.
-// request.Form is map[string][]string.
-// addParam puts value at the end of request.Form[key].
-func addParam(request *http.Request, handler http.Handler, key, value string) {
-	if handler != nil {
-		if request.Form == nil {
-			request.Form = url.Values{}
-		}
-		request.Form.Add(key, value)
+
+// lookup is a method which returns the handlers of the first node matching the
+// path which has a handler for the method matching the request or any handler
+// if the method is "", see accepts.
+// It returns nil if there is no such node.
+// The params matched on the way to the node are added to params, see get.
+func (n *node) lookup(path, method string, request *http.Request,
+	params *Params, fold bool) *handlerArray {
+
+	count := len(*params)
+	handlers := n.match(path, method, request, params, fold)
+	if handlers == nil {
+		// params of the branches which didn't match have to be dropped
+		*params = (*params)[:count]
 	}
+	return handlers
 }
 
-// get is a method which returns a http.Handler for the specified path/method
-// if one exists.
-// It also returns a boolean which is true if the specified path exists.
-func (n *node) get(path, method string,
-	request *http.Request) (http.Handler, bool) {
+// accepts is a method which returns true if the node has a handler for the
+// method matching the request or any handler if the method is "". If the
+// request is nil, any handler for the method is accepted.
+func (n *node) accepts(method string, request *http.Request) bool {
+	if n.handlers == nil || method == "" {
+		return n.handlers != nil
+	} else if request == nil {
+		return n.handlers.get(method) != nil
+	}
+	handler, _ := n.handlers.match(method, request)
+	return handler != nil
+}
+
+// match is a method which matches the path against the node and the nodes
+// below it. It adds the params to params on the way down, see lookup.
+// If a matching node doesn't have a handler for the method matching the
+// request, the other branches are tried.
+func (n *node) match(path, method string, request *http.Request,
+	params *Params, fold bool) *handlerArray {
 
 	if n.path[0] == ':' {
 		// n.path is a param, try matching a param in the path
-		paramLen := indexOf(path, '/')
-		if paramLen == len(path) {
-			// param is the last segment of the path
-			if n.handlers == nil {
-				return nil, false
-			}
-			handler := n.handlers.get(method)
-			addParam(request, handler, n.path[1:], path)
-			// maybe return handler, n.handlers != nil
-			return handler, true
-		}
-		// param is not the last segment, have to check next for next segments
-		for _, next := range n.next {
-			if next.path[0] == '/' {
-				handler, pathFound := next.get(path[paramLen:], method, request)
-				if pathFound {
-					// if path was found, try adding param to the request
-					addParam(request, handler, n.path[1:], path[:paramLen])
-					return handler, pathFound
+		segmentLen := indexOf(path, '/')
+		for paramLen := segmentLen - 1; paramLen > 0; paramLen-- {
+			// the param can end before the end of the segment only if it is
+			// followed by static text, the longest value is tried first
+			if n.precedes(path[paramLen], fold) {
+				handlers := n.matchParam(path, paramLen, method, request,
+					params, fold)
+				if handlers != nil {
+					return handlers
 				}
 			}
 		}
-	} else if len(path) >= len(n.path) && n.path == path[:len(n.path)] {
+		return n.matchParam(path, segmentLen, method, request, params,
+			fold)
+	} else if n.path[0] == '*' {
+		// n.path is a catch-all, it matches the rest of the path
+		if n.accepts(method, request) {
+			addParam(params, n.path[1:], path, nil)
+			return n.handlers
+		}
+	} else if len(path) >= len(n.path) &&
+		equal(n.path, path[:len(n.path)], fold) {
+
 		// n.path matches path exactly to n.paths length
 		if len(path) == len(n.path) {
 			// n.path matched path exactly
-			if n.handlers == nil {
-				return nil, false
+			if n.accepts(method, request) {
+				return n.handlers
+			}
+			// a catch-all can still match the empty rest of the path
+			for _, next := range n.next {
+				if next.path[0] == '*' {
+					return next.lookup("", method, request, params, fold)
+				}
 			}
-			return n.handlers.get(method), true
+			return nil
 		}
 		// path is longer than n.path, have to check next for next segments
 		for _, next := range n.next {
-			if next.path[0] == path[len(n.path)] || next.path[0] == ':' {
-				// next segment matches path or is a param
-				handler, pathFound := next.get(path[len(n.path):], method,
-					request)
-				if pathFound {
-					return handler, pathFound
+			if equal(next.path[:1], path[len(n.path):len(n.path)+1], fold) ||
+				next.path[0] == ':' || next.path[0] == '*' {
+
+				// next segment matches path or is a param or a catch-all
+				handlers := next.lookup(path[len(n.path):], method,
+					request, params, fold)
+				if handlers != nil {
+					return handlers
 				}
 			}
 		}
 	}
 	// no path was found at this branch
-	return nil, false
+	return nil
+}
+
+// precedes is a method which returns true if any of the next nodes starts with
+// c, ie. the node can be followed by c.
+func (n *node) precedes(c byte, fold bool) bool {
+	for _, next := range n.next {
+		if next.path[0] == c || fold && toLower(next.path[0]) == toLower(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParam is a method which matches the param node against the first
+// paramLen bytes of the path and the rest of the path against the next nodes.
+// It adds the params to params on the way down, see lookup.
+func (n *node) matchParam(path string, paramLen int, method string,
+	request *http.Request, params *Params, fold bool) *handlerArray {
+
+	value := path[:paramLen]
+	typed, ok := n.convert(value)
+	if !ok {
+		// the param doesn't satisfy the constraint or isn't of the type, have
+		// to try siblings
+		return nil
+	}
+	if paramLen == len(path) {
+		// param is the last segment of the path
+		if !n.accepts(method, request) {
+			return nil
+		}
+		name, _ := splitParam(n.path)
+		addParam(params, name, value, typed)
+		return n.handlers
+	}
+	// param is not the end of the path, have to check next for the rest
+	for _, next := range n.next {
+		if equal(next.path[:1], path[paramLen:paramLen+1], fold) {
+			name, _ := splitParam(n.path)
+			addParam(params, name, value, typed)
+			handlers := next.lookup(path[paramLen:], method, request,
+				params, fold)
+			if handlers != nil {
+				return handlers
+			}
+			*params = (*params)[:len(*params)-1]
+		}
+	}
+	return nil
+}
+
+// convert is a method which returns the value of the param node converted by
+// its converter, if it has one. It returns false if the value doesn't satisfy
+// the constraint or isn't of the type of the node.
+func (n *node) convert(value string) (interface{}, bool) {
+	if n.constraint != nil && !n.constraint.MatchString(value) {
+		return nil, false
+	}
+	if n.converter != nil {
+		return n.converter(value)
+	}
+	return nil, true
 }
 
 // handle is a method which adds methodHandler to handlers of the node.
 // It creates new handlerArray if necessary.
-func (n *node) handle(method string, handler http.Handler) {
+// It returns false if there already is a handler without matchers for the
+// method and the media types and the handler doesn't have matchers either, see
+// handlerArray.add.
+func (n *node) handle(method string, handler http.Handler,
+	options ...Option) bool {
+
 	if n.handlers == nil {
 		n.handlers = newHandlerArray()
 	}
-	n.handlers.add(method, handler)
+	return n.handlers.add(method, handler, options...)
 }
@@ -1,6 +1,7 @@
 package gocelot
 
 import (
+	"errors"
 	"testing"
 	"net/http"
 )
@@ -14,6 +15,14 @@ func TestNewNodeCreatesEmptyNode(t *testing.T) {
 	}
 }
 
+func addPath(n *node, path string) *node {
+	added, err := n.add(path, nil)
+	if err != nil {
+		panic(err)
+	}
+	return added
+}
+
 func isNodeSeqCorrect(first, last *node, segments ...string) bool {
 	i := 0
 	node := first
@@ -34,7 +43,7 @@ func isNodeSeqCorrect(first, last *node, segments ...string) bool {
 }
 
 func TestNodeSeqForEmptyPathReturnsTwoEmptyNodes(t *testing.T) {
-	first, last := nodeSeq("")
+	first, last := nodeSeq("", nil)
 	if !isNodeSeqCorrect(first, last, "") {
 		t.Fail()
 	}
@@ -42,7 +51,7 @@ func TestNodeSeqForEmptyPathReturnsTwoEmptyNodes(t *testing.T) {
 
 func TestNodeSeqForPathWithoutParamsReturnsTwoSameNodes(t *testing.T) {
 	path := "/some/path/without/params"
-	first, last := nodeSeq(path)
+	first, last := nodeSeq(path, nil)
 	if !isNodeSeqCorrect(first, last, path) {
 		t.Fail()
 	}
@@ -50,7 +59,7 @@ func TestNodeSeqForPathWithoutParamsReturnsTwoSameNodes(t *testing.T) {
 
 func TestNodeSeqForPathEndingWithOpenParam(t *testing.T) {
 	path := "/path/:param"
-	first, last := nodeSeq(path)
+	first, last := nodeSeq(path, nil)
 	if !isNodeSeqCorrect(first, last, "/path/", ":param") {
 		t.Fail()
 	}
@@ -58,7 +67,7 @@ func TestNodeSeqForPathEndingWithOpenParam(t *testing.T) {
 
 func TestNodeSeqForPathEndingWithClosedParam(t *testing.T) {
 	path := "/path/:param/"
-	first, last := nodeSeq(path)
+	first, last := nodeSeq(path, nil)
 	if !isNodeSeqCorrect(first, last, "/path/", ":param", "/") {
 		t.Fail()
 	}
@@ -67,7 +76,7 @@ func TestNodeSeqForPathEndingWithClosedParam(t *testing.T) {
 
 func TestNodeSeqForParamOnlyPath(t *testing.T) {
 	path := ":param"
-	first, last := nodeSeq(path)
+	first, last := nodeSeq(path, nil)
 	if !isNodeSeqCorrect(first, last, path) {
 		t.Fail()
 	}
@@ -75,7 +84,7 @@ func TestNodeSeqForParamOnlyPath(t *testing.T) {
 
 func TestNodeSeqForPathWithMultipleParams(t *testing.T) {
 	path := "path/:a/:b/:c/break/:d/:e/end"
-	first, last := nodeSeq(path)
+	first, last := nodeSeq(path, nil)
 	if !isNodeSeqCorrect(first, last, "path/", ":a", "/", ":b", "/", ":c",
 		"/break/", ":d", "/", ":e", "/end") {
 
@@ -154,65 +163,80 @@ func TestHandleDoesNotAddHandlerForExistingMethod(t *testing.T) {
 	}
 }
 
-func TestAddParamAddsParamIfHandlerIsNotNil(t *testing.T) {
-	request, _ := http.NewRequest("GET", "/path", nil)
-	addParam(request, emptyHandler, "key", "value")
-	if request.Form == nil || request.Form.Get("key") != "value" {
+func TestAddParamAddsParamToTheEndOfParams(t *testing.T) {
+	var params Params
+	addParam(&params, "key", "value", nil)
+	addParam(&params, "key", "differentValue", nil)
+	if len(params) != 2 || params[0] != (Param{"key", "value", nil}) ||
+		params[1] != (Param{"key", "differentValue", nil}) {
+
 		t.Fail()
 	}
 }
 
-func TestAddParamDoesNotAddParamIfHandlerIsNil(t *testing.T) {
-	request, _ := http.NewRequest("GET", "/path", nil)
-	addParam(request, nil, "key", "value")
-	if request.Form != nil {
+func TestAddOfTheSamePathReturnsTheNode(t *testing.T) {
+	node := newNode()
+	node.path = "/path"
+	added, _ := node.add("/path", nil)
+	if added == nil || added != node {
 		t.Fail()
 	}
 }
 
-func TestAddParamAddsParamToTheEndOfUrlValuesArray(t *testing.T) {
-	request, _ := http.NewRequest("GET", "/path", nil)
-	addParam(request, emptyHandler, "key", "value")
-	addParam(request, emptyHandler, "key", "differentValue")
-	if request.Form == nil || request.Form["key"] == nil ||
-		len(request.Form["key"]) != 2 || request.Form["key"][0] != "value" ||
-		request.Form["key"][1] != "differentValue" {
-	
+func TestAddOfDifferentLongerParamReturnsNilAndError(t *testing.T) {
+	node := newNode()
+	node.path = ":param"
+	added, err := node.add(":params", nil)
+	if added != nil || !errors.Is(err, ErrParamConflict) {
 		t.Fail()
 	}
+}
 
+func TestAddOfDifferentShorterParamReturnsNilAndError(t *testing.T) {
+	node := newNode()
+	node.path = ":param"
+	added, err := node.add(":par", nil)
+	if added != nil || !errors.Is(err, ErrParamConflict) {
+		t.Fail()
+	}
 }
 
-func TestAddOfTheSamePathReturnsTheNode(t *testing.T) {
+func TestAddOfDifferentParamFollowedBySlashReturnsNilAndError(t *testing.T) {
 	node := newNode()
-	node.path = "/path"
-	added := node.add("/path")
-	if added == nil || added != node {
+	node.path = ":params"
+	added, err := node.add(":par/end", nil)
+	if added != nil || !errors.Is(err, ErrParamConflict) ||
+		node.path != ":params" {
+
 		t.Fail()
 	}
 }
 
-func TestAddOfDifferentLongerParamReturnsNil(t *testing.T) {
+func TestAddOfDifferentParamAtTheSamePositionReturnsError(t *testing.T) {
 	node := newNode()
-	node.path = ":param"
-	added := node.add(":params")
-	if added != nil {
+	node.path = "/"
+	addPath(node, "/path/:a/end")
+	_, err := node.add("/path/:b/end", nil)
+	if !errors.Is(err, ErrParamConflict) {
+		t.Fail()
+	}
+	if _, err := node.add("/path/:a/:b", nil); err != nil {
 		t.Fail()
 	}
 }
 
-func TestAddOfDifferentShorterParamReturnsNil(t *testing.T) {
+func TestAddOfDifferentCatchAllAtTheSamePositionReturnsError(t *testing.T) {
 	node := newNode()
-	node.path = ":param"
-	added := node.add(":par")
-	if added != nil {
+	node.path = "/"
+	addPath(node, "/path/*a")
+	if _, err := node.add("/path/*b", nil); !errors.Is(err, ErrParamConflict) {
 		t.Fail()
 	}
 }
 
 func TestAddOfSamePathReturnsTheSameLastNode(t *testing.T) {
-	node, last := nodeSeq("/path/:param/end")
-	added := node.add("/path/:param/end")
+	node, last := nodeSeq("/path/:param/end", nil)
+	added, _ := node.add("/path/:param/end", nil)
 	if added == nil || added != last {
 		t.Fail()
 	}
@@ -221,7 +245,7 @@ func TestAddOfSamePathReturnsTheSameLastNode(t *testing.T) {
 func TestAddOfShorterPathReturnsTheNodeWithChangedPath(t *testing.T) {
 	node := newNode()
 	node.path = "/path/end"
-	added := node.add("/path")
+	added, _ := node.add("/path", nil)
 	if added == nil || added != node || added.path != "/path" {
 		t.Fail()
 	}
@@ -230,7 +254,7 @@ func TestAddOfShorterPathReturnsTheNodeWithChangedPath(t *testing.T) {
 func TestAddOfDifferentPathReturnsTheEndOfNewNodeSeq(t *testing.T) {
 	node := newNode()
 	node.path = "/path/one"
-	added := node.add("/path/two/:param/end")
+	added, _ := node.add("/path/two/:param/end", nil)
 	if added == nil || added == node || added.path != "/end" ||
 		node.path != "/path/" {
 		
@@ -243,21 +267,25 @@ func TestGetOfOpenParamReturnsHandlerAndTrue(t *testing.T) {
 	node.path = ":key"
 	request, _ := http.NewRequest("GET", "value", nil)
 	node.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != emptyHandler || !pathFound || request.Form == nil ||
-		request.Form.Get("key") != "value" {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) == 0 ||
+		params.Get("key") != "value" {
 		
 		t.Fail()
 	}
 }
 
 func TestGetOfClosedParamReturnsHandlerAndTrue(t *testing.T) {
-	node, last := nodeSeq(":key/")
+	node, last := nodeSeq(":key/", nil)
 	request, _ := http.NewRequest("GET", "value/", nil)
 	last.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != emptyHandler || !pathFound || request.Form == nil ||
-		request.Form.Get("key") != "value" {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) == 0 ||
+		params.Get("key") != "value" {
 		
 		t.Fail()
 	}
@@ -268,8 +296,10 @@ func TestGetOfNonMatchingParamReturnsNilAndFalse(t *testing.T) {
 	node.path = ":key"
 	request, _ := http.NewRequest("GET", "value/", nil)
 	node.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers != nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -279,8 +309,10 @@ func TestGetOfMatchingPathReturnsHandlerAndTrue(t *testing.T) {
 	node.path = "/"
 	request, _ := http.NewRequest("GET", "/", nil)
 	node.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != emptyHandler || !pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -290,8 +322,10 @@ func TestGetOfNonMatchingPathReturnsNilAndFalse(t *testing.T) {
 	node.path = "/path/"
 	request, _ := http.NewRequest("GET", "/path", nil)
 	node.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || pathFound {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers != nil {
 		t.Fail()
 	}
 }
@@ -304,8 +338,10 @@ func TestGetOfLongerMatchingPathReturnsHandlerAndTrue(t *testing.T) {
 	node.next = append(node.next, nextNode)
 	request, _ := http.NewRequest("GET", "/path", nil)
 	nextNode.handle(request.Method, emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != emptyHandler || !pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -314,8 +350,10 @@ func TestGetOfMatchingPathWithoutHandlersReturnsNilAndFalse(t *testing.T) {
 	node := newNode()
 	node.path = "/"
 	request, _ := http.NewRequest("GET", "/", nil)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers != nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -325,8 +363,10 @@ func TestGetOfMatchingParamWithoutHandlersReturnsNilAndFalse(t *testing.T) {
 	node := newNode()
 	node.path = ":key"
 	request, _ := http.NewRequest("GET", "value", nil)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers != nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -336,8 +376,10 @@ func TestGetOfMatchingPathWithDifferentHandlerReturnsNilAndTrue(t *testing.T) {
 	node.path = "/"
 	request, _ := http.NewRequest("GET", "/", nil)
 	node.handle("POST", emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || !pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers == nil || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -347,8 +389,685 @@ func TestGetOfMatchingParamWithDifferentHandlerReturnsNilAndTrue(t *testing.T) {
 	node.path = ":key"
 	request, _ := http.NewRequest("GET", "value", nil)
 	node.handle("POST", emptyHandler)
-	handler, pathFound := node.get(request.URL.Path, request.Method, request)
-	if handler != nil || !pathFound || request.Form != nil {
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != nil || handlers == nil || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestNodeSeqForPathEndingWithCatchAll(t *testing.T) {
+	path := "/path/:param/*rest"
+	first, last := nodeSeq(path, nil)
+	if !isNodeSeqCorrect(first, last, "/path/", ":param", "/", "*rest") {
+		t.Fail()
+	}
+}
+
+func TestValidatePathAcceptsValidPaths(t *testing.T) {
+	for _, path := range []string{"/", "/path", "/path/:a/:b/", "/v:version",
+		"/path/*rest", "/*rest"} {
+
+		if validatePath(path, builtinConverters) != nil {
+			t.Error(path)
+		}
+	}
+}
+
+func TestValidatePathRejectsInvalidPaths(t *testing.T) {
+	for _, path := range []string{"", "path", ":param", "/path/:", "/:/end",
+		"/path/*", "/path/:a:b", "/path/:a*b", "/path/*rest/end",
+		"/path*rest"} {
+
+		if !errors.Is(validatePath(path, builtinConverters), ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+}
+
+func TestAddKeepsNextNodesInOrderOfSpecificity(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/*rest")
+	addPath(node, "/:param")
+	addPath(node, "/:id|int")
+	addPath(node, "/path")
+	if len(node.next) != 4 || node.next[0].path != "path" ||
+		node.next[1].path != ":id|int" || node.next[2].path != ":param" ||
+		node.next[3].path != "*rest" {
+
+		t.Fail()
+	}
+}
+
+func TestGetOfCatchAllReturnsHandlerAndTrue(t *testing.T) {
+	node, last := nodeSeq("/path/*rest", nil)
+	request, _ := http.NewRequest("GET", "/path/to/some/file", nil)
+	last.handle(request.Method, emptyHandler)
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) == 0 ||
+		params.Get("rest") != "to/some/file" {
+
+		t.Fail()
+	}
+}
+
+func TestGetOfCatchAllMatchesEmptyRest(t *testing.T) {
+	node, last := nodeSeq("/path/*rest", nil)
+	request, _ := http.NewRequest("GET", "/path/", nil)
+	last.handle(request.Method, emptyHandler)
+	var params Params
+	handler, handlers := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || handlers == nil || len(params) == 0 ||
+		len(params) != 1 || params.Get("rest") != "" {
+
+		t.Fail()
+	}
+}
+
+func TestGetPrefersStaticAndParamOverCatchAll(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/*rest").handle("GET", emptyHandler)
+	addPath(node, "/static").handle("GET", differentEmptyHandler)
+	addPath(node, "/:param/end").handle("GET", differentEmptyHandler)
+
+	request, _ := http.NewRequest("GET", "/static", nil)
+	var params Params
+	handler, _ := node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != differentEmptyHandler || len(params) != 0 {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/value/end", nil)
+	params = nil
+	handler, _ = node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != differentEmptyHandler || params.Get("param") != "value" {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/value/other", nil)
+	params = nil
+	handler, _ = node.get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler || params.Get("rest") != "value/other" {
+		t.Fail()
+	}
+}
+
+func TestFindReturnsNodeHoldingExactlyThePath(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	added, _ := node.add("/path/:param/end", nil)
+	if node.find("/path/:param/end") != added {
+		t.Fail()
+	}
+}
+
+func TestFindOfNonExistingPathReturnsNil(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/path/:param/end")
+	if node.find("/path/:param/en") != nil ||
+		node.find("/path/:other/end") != nil || node.find("/paths") != nil {
+
+		t.Fail()
+	}
+}
+
+func TestWalkVisitsAllNodesWithHandlers(t *testing.T) {
+	root := newNode()
+	root.path = "/"
+	addPath(root, "/path/:param").handle("GET", emptyHandler)
+	addPath(root, "/path/end").handle("GET", emptyHandler)
+	addPath(root, "/other/*rest").handle("GET", emptyHandler)
+	var paths []string
+	root.walk("/prefix", func(path string, _ *node) {
+		paths = append(paths, path)
+	})
+	if len(paths) != 3 || paths[0] != "/prefix/path/end" ||
+		paths[1] != "/prefix/path/:param" || paths[2] != "/prefix/other/*rest" {
+
+		t.Fail()
+	}
+}
+
+func TestCountParamsCountsParamsAndCatchAlls(t *testing.T) {
+	if countParams("/path") != 0 || countParams("/:a/path/:b/*rest") != 3 {
+		t.Fail()
+	}
+}
+
+func BenchmarkGetOfStaticPath(b *testing.B) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/all/posts").handle("GET", emptyHandler)
+	params := make(Params, 0, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		node.get("/users/all/posts", "GET", nil, &params, false)
+	}
+}
+
+func BenchmarkGetOfPathWithParams(b *testing.B) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:id/posts/:post").handle("GET", emptyHandler)
+	params := make(Params, 0, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		node.get("/users/1/posts/2", "GET", nil, &params, false)
+	}
+}
+
+func TestGetAddsParamsInPathOrder(t *testing.T) {
+	node, last := nodeSeq("/path/:key/:key/:key/:otherKey", nil)
+	last.handle("GET", emptyHandler)
+	var params Params
+	node.get("/path/1/2/3/4", "GET", nil, &params, false)
+	if len(params) != 4 || params[0] != (Param{"key", "1", nil}) ||
+		params[1] != (Param{"key", "2", nil}) ||
+		params[2] != (Param{"key", "3", nil}) ||
+		params[3] != (Param{"otherKey", "4", nil}) {
+
+		t.Fail()
+	}
+}
+
+func TestGetDropsParamsOfBranchesWhichDidNotMatch(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/:a/:b/end").handle("GET", emptyHandler)
+	addPath(node, "/:a/other/:c").handle("GET", differentEmptyHandler)
+	params := Params{{"host", "value", nil}}
+	handler, _ := node.get("/1/other/3", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || len(params) != 3 ||
+		params[0] != (Param{"host", "value", nil}) ||
+		params[1] != (Param{"a", "1", nil}) ||
+		params[2] != (Param{"c", "3", nil}) {
+
+		t.Fail()
+	}
+}
+
+func TestEqualComparesExactlyWithoutFold(t *testing.T) {
+	if !equal("/path", "/path", false) || equal("/path", "/Path", false) {
+		t.Fail()
+	}
+}
+
+func TestEqualIgnoresCaseOfASCIILettersWithFold(t *testing.T) {
+	if !equal("/path-1", "/PaTh-1", true) || equal("/path", "/paths", true) ||
+		equal("/path", "/bath", true) || equal("/ą", "/Ą", true) {
+
+		t.Fail()
+	}
+}
+
+func TestGetWithFoldMatchesStaticPartsIgnoringCase(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:name/posts").handle("GET", emptyHandler)
+	var params Params
+	handler, _ := node.get("/Users/John/POSTS", "GET", nil, &params, false)
+	if handler != nil || len(params) != 0 {
+		t.Fail()
+	}
+	handler, _ = node.get("/Users/John/POSTS", "GET", nil, &params, true)
+	if handler != emptyHandler || params.Get("name") != "John" {
+		t.Fail()
+	}
+}
+
+func TestGetWithFoldTriesAllMatchingStaticNodes(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/Users/all").handle("GET", emptyHandler)
+	addPath(node, "/users/:id").handle("GET", differentEmptyHandler)
+	var params Params
+	handler, _ := node.get("/USERS/1", "GET", nil, &params, true)
+	if handler != differentEmptyHandler || params.Get("id") != "1" {
+		t.Fail()
+	}
+}
+
+func TestSplitParamReturnsNameAndConstraint(t *testing.T) {
+	if name, constraint := splitParam(":id<[0-9]+>"); name != "id" ||
+		constraint != "<[0-9]+>" {
+
+		t.Fail()
+	}
+	if name, constraint := splitParam(":id|int"); name != "id" ||
+		constraint != "|int" {
+
+		t.Fail()
+	}
+	if name, constraint := splitParam("*rest"); name != "rest" ||
+		constraint != "" {
+
+		t.Fail()
+	}
+}
+
+func TestNodeSeqCompilesConstraintsOfParams(t *testing.T) {
+	first, last := nodeSeq("/path/:id<[0-9]+>/:name", nil)
+	if !isNodeSeqCorrect(first, last, "/path/", ":id<[0-9]+>", "/",
+		":name") {
+
+		t.Fail()
+	}
+	param := first.next[0]
+	if param.constraint == nil || !param.constraint.MatchString("42") ||
+		param.constraint.MatchString("a42") || last.constraint != nil {
+
+		t.Fail()
+	}
+}
+
+func TestValidatePathAcceptsConstrainedParams(t *testing.T) {
+	for _, path := range []string{"/:id<[0-9]+>", "/:a<(?:x|y)*>/:b<.>/",
+		"/path/:id<\\d+>/*rest"} {
+
+		if validatePath(path, builtinConverters) != nil {
+			t.Error(path)
+		}
+	}
+}
+
+func TestValidatePathRejectsMalformedConstraints(t *testing.T) {
+	for _, path := range []string{"/:id<", "/:id<>", "/:id<[>",
+		"/:<[0-9]+>", "/:id<[^/]+>", "/*rest<.+>"} {
+
+		if !errors.Is(validatePath(path, builtinConverters), ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+}
+
+func TestAddOfParamsWithDifferentConstraintsCreatesSiblings(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/:name")
+	addPath(node, "/:id<[0-9]+>/end")
+	addPath(node, "/:slug<[a-z]+>")
+	if len(node.next) != 3 || node.next[0].path != ":id<[0-9]+>" ||
+		node.next[1].path != ":slug<[a-z]+>" || node.next[2].path != ":name" {
+
+		t.Fail()
+	}
+	if addPath(node, "/:id<[0-9]+>/end") != node.next[0].next[0] {
+		t.Fail()
+	}
+}
+
+func TestAddOfDifferentParamWithTheSameConstraintReturnsError(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/:id<[0-9]+>")
+	_, err := node.add("/:num<[0-9]+>", nil)
+	if !errors.Is(err, ErrParamConflict) {
+		t.Fail()
+	}
+}
+
+func TestGetTriesSiblingsIfConstraintDoesNotMatch(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:id<[0-9]+>").handle("GET", emptyHandler)
+	addPath(node, "/users/:name").handle("GET", differentEmptyHandler)
+	var params Params
+	handler, _ := node.get("/users/42", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 1 ||
+		params.Get("id") != "42" {
+
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/users/42a", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || len(params) != 1 ||
+		params.Get("name") != "42a" {
+
+		t.Fail()
+	}
+}
+
+func TestGetOfNonMatchingConstraintReturnsNil(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:id<[0-9]+>").handle("GET", emptyHandler)
+	var params Params
+	handler, handlers := node.get("/users/new", "GET", nil, &params, false)
+	if handler != nil || handlers != nil || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestCountParamsIgnoresSpecialCharactersOfConstraints(t *testing.T) {
+	if countParams("/:a<(?:x|y)*>/:b<.*>/*rest") != 3 {
+		t.Fail()
+	}
+}
+
+func TestNodeSeqLooksUpConvertersOfTypedParams(t *testing.T) {
+	first, last := nodeSeq("/path/:id|int", builtinConverters)
+	if !isNodeSeqCorrect(first, last, "/path/", ":id|int") ||
+		last.converter == nil || first.converter != nil {
+
+		t.Fail()
+	}
+}
+
+func TestValidatePathRejectsUnknownTypes(t *testing.T) {
+	for _, path := range []string{"/:id|", "/:id|unknown", "/:id|int<[0-9]+>",
+		"/*rest|int"} {
+
+		if !errors.Is(validatePath(path, builtinConverters), ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+	if validatePath("/:id|int/:name|slug", builtinConverters) != nil {
+		t.Fail()
+	}
+}
+
+func TestGetConvertsTypedParamsAndTriesSiblingsIfConversionFails(
+	t *testing.T) {
+
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:name").handle("GET", differentEmptyHandler)
+	added, _ := node.add("/users/:id|int", builtinConverters)
+	added.handle("GET", emptyHandler)
+	if node.next[0].next[0] != added {
+		t.Fail()
+	}
+	var params Params
+	handler, _ := node.get("/users/42", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 1 ||
+		params[0] != (Param{"id", "42", 42}) {
+
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/users/john", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || len(params) != 1 ||
+		params[0] != (Param{"name", "john", nil}) {
+
+		t.Fail()
+	}
+}
+
+func TestTokenEndReturnsLengthOfParamWithConstraint(t *testing.T) {
+	for token, end := range map[string]int{":name.:ext": 5, ":id/end": 3,
+		":id<[0-9]{2}>/end": 13, ":a<(?P<b>x)>-": 12, ":id|int.json": 7,
+		"*rest": 5, ":id<[^/]+>": 6} {
+
+		if tokenEnd(token) != end {
+			t.Error(token)
+		}
+	}
+}
+
+func TestNodeSeqForPathWithEmbeddedParams(t *testing.T) {
+	first, last := nodeSeq("/files/:name.:ext|slug/v:version", nil)
+	if !isNodeSeqCorrect(first, last, "/files/", ":name", ".", ":ext|slug",
+		"/v", ":version") {
+
+		t.Fail()
+	}
+}
+
+func TestValidatePathAcceptsEmbeddedParams(t *testing.T) {
+	for _, path := range []string{"/files/:name.:ext", "/v:version/",
+		"/:a-:b-:c", "/:id<[0-9]+>.json", "/:date|date.:format"} {
+
+		if validatePath(path, builtinConverters) != nil {
+			t.Error(path)
+		}
+	}
+}
+
+func TestValidatePathRejectsAdjacentParams(t *testing.T) {
+	for _, path := range []string{"/:a:b", "/:a<x>:b", "/:a|int:b",
+		"/:a*b", "/v*rest", "/*rest.txt"} {
+
+		if !errors.Is(validatePath(path, builtinConverters), ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+}
+
+func TestGetOfEmbeddedParamsMatchesLongestValueFirst(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/files/:name.:ext").handle("GET", emptyHandler)
+	var params Params
+	handler, _ := node.get("/files/archive.tar.gz", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 2 ||
+		params.Get("name") != "archive.tar" || params.Get("ext") != "gz" {
+
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/files/archive", "GET", nil, &params, false)
+	if handler != nil || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestGetOfEmbeddedParamPrefersStaticSuffix(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/files/:name").handle("GET", emptyHandler)
+	addPath(node, "/files/:name.json").handle("GET", differentEmptyHandler)
+	var params Params
+	handler, _ := node.get("/files/data.json", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || len(params) != 1 ||
+		params.Get("name") != "data" {
+
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/files/data.xml", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 1 ||
+		params.Get("name") != "data.xml" {
+
+		t.Fail()
+	}
+}
+
+func TestGetOfEmbeddedParamsChecksConstraintsOfEachValue(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/v:major<[0-9]+>.:minor<[0-9]+>/end").handle("GET",
+		emptyHandler)
+	var params Params
+	handler, _ := node.get("/v1.20/end", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 2 ||
+		params.Get("major") != "1" || params.Get("minor") != "20" {
+
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/v1.2.3/end", "GET", nil, &params, false)
+	if handler != nil || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestValidatePathRejectsUnexpandedOptionalParts(t *testing.T) {
+	for _, path := range []string{"/posts[/:page]", "/posts/:page?",
+		"/posts]"} {
+
+		if !errors.Is(validatePath(path, nil), ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+	if validatePath("/:id<[0-9]?>", nil) != nil {
+		t.Fail()
+	}
+}
+
+func TestGetTriesStaticBeforeParamRegardlessOfAddOrder(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/:id").handle("GET", differentEmptyHandler)
+	addPath(node, "/users/new").handle("GET", emptyHandler)
+	var params Params
+	handler, _ := node.get("/users/new", "GET", nil, &params, false)
+	if handler != emptyHandler || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestGetBacktracksFromStaticWithoutMethodToParam(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/new").handle("POST", emptyHandler)
+	addPath(node, "/users/:id").handle("GET", differentEmptyHandler)
+	var params Params
+	handler, _ := node.get("/users/new", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || params.Get("id") != "new" {
+		t.Fail()
+	}
+	params = params[:0]
+	handler, _ = node.get("/users/new", "POST", nil, &params, false)
+	if handler != emptyHandler || len(params) != 0 {
+		t.Fail()
+	}
+}
+
+func TestGetBacktracksToCatchAllFromNodesWithoutMethod(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/files/index").handle("POST", emptyHandler)
+	addPath(node, "/files/:name<[a-z]+>").handle("PUT", emptyHandler)
+	addPath(node, "/files/*rest").handle("GET", differentEmptyHandler)
+	for _, path := range []string{"/files/index", "/files/other",
+		"/files/a/b"} {
+
+		var params Params
+		handler, _ := node.get(path, "GET", nil, &params, false)
+		if handler != differentEmptyHandler || len(params) != 1 ||
+			params.Get("rest") != path[len("/files/"):] {
+
+			t.Error(path)
+		}
+	}
+}
+
+func TestGetBacktracksFromDeeperNodesWithoutMethod(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/a/:b/c").handle("POST", emptyHandler)
+	addPath(node, "/a/:b|int/:d").handle("DELETE", emptyHandler)
+	addPath(node, "/a/:b/:d").handle("GET", differentEmptyHandler)
+	var params Params
+	handler, _ := node.get("/a/1/c", "GET", nil, &params, false)
+	if handler != differentEmptyHandler || len(params) != 2 ||
+		params[0] != (Param{"b", "1", nil}) ||
+		params[1] != (Param{"d", "c", nil}) {
+
+		t.Fail()
+	}
+}
+
+func TestGetWithoutHandlerForMethodReturnsHandlersOfFirstMatchingNode(
+	t *testing.T) {
+
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/new").handle("POST", emptyHandler)
+	addPath(node, "/users/:id").handle("GET", emptyHandler)
+	params := Params{{"host", "value", nil}}
+	handler, handlers := node.get("/users/new", "PUT", nil, &params, false)
+	if handler != nil || handlers == nil || handlers.get("POST") == nil ||
+		handlers.get("GET") != nil || len(params) != 1 {
+		t.Fail()
+	}
+}
+
+func TestCompactRemovesNodesWithoutHandlersAndNext(t *testing.T) {
+	root := newNode()
+	root.path = "/"
+	addPath(root, "/users/:id").handle("GET", emptyHandler)
+	addPath(root, "/posts").handle("GET", emptyHandler)
+	addPath(root, "/posts").handlers.remove("GET")
+	root.compact()
+	if len(root.next) != 1 || root.next[0].path != "users/" ||
+		root.find("/posts") != nil {
+
+		t.Fail()
+	}
+}
+
+func TestCompactMergesStaticNodeWithItsOnlyStaticNext(t *testing.T) {
+	root := newNode()
+	root.path = "/"
+	addPath(root, "/users/new").handle("GET", emptyHandler)
+	addPath(root, "/users/:id").handle("GET", emptyHandler)
+	addPath(root, "/users/:id").handlers.remove("GET")
+	root.compact()
+	if len(root.next) != 1 || root.next[0].path != "users/new" ||
+		root.next[0].handlers == nil || len(root.next[0].next) != 0 {
+
+		t.Fail()
+	}
+}
+
+func TestCompactKeepsParamNodes(t *testing.T) {
+	root := newNode()
+	root.path = "/"
+	addPath(root, "/files/:name.:ext").handle("GET", emptyHandler)
+	addPath(root, "/files/:name.zip").handle("GET", emptyHandler)
+	addPath(root, "/files/:name.zip").handlers.remove("GET")
+	root.compact()
+	if root.find("/files/:name.:ext") == nil ||
+		root.find("/files/:name.zip") != nil ||
+		root.find("/files/:name.") == nil {
+
+		t.Fail()
+	}
+}
+
+func TestCloneCopiesNodesAndHandlers(t *testing.T) {
+	root := newNode()
+	root.path = "/"
+	addPath(root, "/users/:id").handle("GET", emptyHandler)
+	copied := root.clone()
+	addPath(copied, "/users/new").handle("GET", emptyHandler)
+	copied.find("/users/:id").handle("POST", emptyHandler)
+	if root.find("/users/new") != nil ||
+		len(root.find("/users/:id").handlers.nodes) != 1 ||
+		copied.find("/users/new") == nil {
+
+		t.Fail()
+	}
+}
+
+func TestGetSkipsNodesWhoseMatchersAreNotSatisfied(t *testing.T) {
+	node := newNode()
+	node.path = "/"
+	addPath(node, "/users/new").handle("GET", emptyHandler, Query("a"))
+	addPath(node, "/users/:id").handle("GET", differentEmptyHandler)
+	request, _ := http.NewRequest("GET", "/users/new", nil)
+	var params Params
+	handler, _ := node.get("/users/new", "GET", request, &params, false)
+	if handler != differentEmptyHandler || params.Get("id") != "new" {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/users/new?a", nil)
+	params = params[:0]
+	handler, _ = node.get("/users/new", "GET", request, &params, false)
+	if handler != emptyHandler || len(params) != 0 {
 		t.Fail()
 	}
 }
@@ -0,0 +1,97 @@
+package gocelot
+
+import (
+	"context"
+	"time"
+)
+
+// Param represents a single url parameter, ie. a key/value pair.
+// Typed holds the value converted by the converter of the param type, eg.
+// int for ':id|int', or nil if the param doesn't have a type.
+type Param struct {
+	Key string
+	Value string
+	Typed interface{}
+}
+
+// Params holds the url parameters matched for a request in the order they
+// appear in the url.
+type Params []Param
+
+// paramsKey is the type of the key under which Params are stored in the
+// request context.
+type paramsKey struct{}
+
+// ParamsFromContext function returns the Params stored in the context by the
+// router or nil if there are none.
+// The router reuses Params after the handler returns, so they mustn't be
+// retained.
+func ParamsFromContext(ctx context.Context) Params {
+	if params, ok := ctx.Value(paramsKey{}).(*Params); ok {
+		return *params
+	}
+	return nil
+}
+
+// Get method returns the value of the first param with the given key or ""
+// if there is no such param.
+func (ps Params) Get(key string) string {
+	for _, param := range ps {
+		if param.Key == key {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// ByIndex method returns the value of the i-th param or "" if there is no such
+// param. It allows using paths with repeated param names, eg. for
+// "/path/:key/:key" ByIndex(1) returns the value of the second key.
+func (ps Params) ByIndex(i int) string {
+	if i < 0 || i >= len(ps) {
+		return ""
+	}
+	return ps[i].Value
+}
+
+// Typed method returns the typed value of the first param with the given key
+// or nil if there is no such param or it doesn't have a type.
+func (ps Params) Typed(key string) interface{} {
+	for _, param := range ps {
+		if param.Key == key {
+			return param.Typed
+		}
+	}
+	return nil
+}
+
+// Int method returns the value of the first param with the given key declared
+// as ':key|int'. It returns false if there is no such param or it isn't an int.
+func (ps Params) Int(key string) (int, bool) {
+	i, ok := ps.Typed(key).(int)
+	return i, ok
+}
+
+// Uint method returns the value of the first param with the given key declared
+// as ':key|uint'. It returns false if there is no such param or it isn't an
+// uint.
+func (ps Params) Uint(key string) (uint, bool) {
+	u, ok := ps.Typed(key).(uint)
+	return u, ok
+}
+
+// UUID method returns the value of the first param with the given key declared
+// as ':key|uuid'. It returns false if there is no such param or it isn't an
+// UUID.
+func (ps Params) UUID(key string) (UUID, bool) {
+	u, ok := ps.Typed(key).(UUID)
+	return u, ok
+}
+
+// Date method returns the value of the first param with the given key declared
+// as ':key|date'. It returns false if there is no such param or it isn't a
+// date.
+func (ps Params) Date(key string) (time.Time, bool) {
+	date, ok := ps.Typed(key).(time.Time)
+	return date, ok
+}
@@ -0,0 +1,84 @@
+package gocelot
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParamsFromContextReturnsStoredParams(t *testing.T) {
+	params := Params{{"key", "value", nil}}
+	ctx := context.WithValue(context.Background(), paramsKey{}, &params)
+	stored := ParamsFromContext(ctx)
+	if len(stored) != 1 || stored[0] != params[0] {
+		t.Fail()
+	}
+}
+
+func TestParamsFromContextWithoutParamsReturnsNil(t *testing.T) {
+	if ParamsFromContext(context.Background()) != nil {
+		t.Fail()
+	}
+}
+
+func TestGetReturnsValueOfTheFirstParamWithTheKey(t *testing.T) {
+	params := Params{{"key", "value", nil}, {"other", "otherValue", nil},
+		{"key", "differentValue", nil}}
+	if params.Get("key") != "value" || params.Get("other") != "otherValue" {
+		t.Fail()
+	}
+}
+
+func TestGetOfNonExistingKeyReturnsEmptyString(t *testing.T) {
+	var params Params
+	if params.Get("key") != "" {
+		t.Fail()
+	}
+}
+
+func TestByIndexReturnsValueOfTheParamAtTheIndex(t *testing.T) {
+	params := Params{{"key", "value", nil}, {"key", "differentValue", nil}}
+	if params.ByIndex(0) != "value" || params.ByIndex(1) != "differentValue" {
+		t.Fail()
+	}
+}
+
+func TestByIndexOutOfRangeReturnsEmptyString(t *testing.T) {
+	params := Params{{"key", "value", nil}}
+	if params.ByIndex(-1) != "" || params.ByIndex(1) != "" {
+		t.Fail()
+	}
+}
+
+func TestTypedReturnsTypedValueOfTheFirstParamWithTheKey(t *testing.T) {
+	params := Params{{"key", "value", nil}, {"id", "1", 1}, {"id", "2", 2}}
+	if params.Typed("id") != 1 || params.Typed("key") != nil ||
+		params.Typed("other") != nil {
+
+		t.Fail()
+	}
+}
+
+func TestTypedAccessorsReturnValuesOfTheirTypes(t *testing.T) {
+	date := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	params := Params{{"int", "-1", -1}, {"uint", "1", uint(1)},
+		{"uuid", "", UUID{1}}, {"date", "2020-01-02", date}}
+	if i, ok := params.Int("int"); !ok || i != -1 {
+		t.Fail()
+	}
+	if u, ok := params.Uint("uint"); !ok || u != 1 {
+		t.Fail()
+	}
+	if u, ok := params.UUID("uuid"); !ok || u != (UUID{1}) {
+		t.Fail()
+	}
+	if d, ok := params.Date("date"); !ok || !d.Equal(date) {
+		t.Fail()
+	}
+	if _, ok := params.Int("uint"); ok {
+		t.Fail()
+	}
+	if _, ok := params.Date("other"); ok {
+		t.Fail()
+	}
+}
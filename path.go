@@ -0,0 +1,175 @@
+package gocelot
+
+import (
+	"fmt"
+	"net/url"
+	gopath "path"
+	"strings"
+)
+
+// cleanPath function returns the canonical form of the url path, ie. the path
+// which starts with '/' and doesn't contain the superfluous '/', './' and '../'
+// elements. Unlike path.Clean, it keeps the trailing '/'.
+func cleanPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	if path[0] != '/' {
+		path = "/" + path
+	}
+	cleaned := gopath.Clean(path)
+	if path[len(path)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// toggleTrailingSlash function returns the path with the trailing '/' removed
+// if it has one or added if it doesn't.
+func toggleTrailingSlash(path string) string {
+	if path != "" && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// escapePath function returns the decoded url path percent-encoded again, so
+// that it can be sent to the client, eg. in the Location header.
+// Eg.
+// escapePath("/files/a?b c")
+// returns "/files/a%3Fb%20c".
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+// fillPath function returns the path with its params(':') and catch-alls('*')
+// replaced with the values of params, in order.
+// Eg.
+// fillPath("/users/:id/*rest", Params{{"id", "1", nil}, {"rest", "a/b", nil}})
+// returns "/users/1/a/b".
+func fillPath(path string, params Params) string {
+	var filled strings.Builder
+	i := 0
+	for start := 0; start < len(path); {
+		if path[start] != ':' && path[start] != '*' {
+			end := start + strings.IndexAny(path[start:], ":*")
+			if end < start {
+				end = len(path)
+			}
+			filled.WriteString(path[start:end])
+			start = end
+			continue
+		}
+		filled.WriteString(params.ByIndex(i))
+		i++
+		start += tokenEnd(path[start:])
+	}
+	return filled.String()
+}
+
+// stripPort function returns the host without the port, if it has one.
+// Eg. stripPort("example.com:8080") returns "example.com" and
+// stripPort("[::1]:8080") returns "[::1]".
+func stripPort(host string) string {
+	colon := strings.LastIndexByte(host, ':')
+	if colon < 0 || colon < strings.LastIndexByte(host, ']') {
+		return host
+	}
+	return host[:colon]
+}
+
+// stripPatternPort function returns the host pattern without the port, if it
+// has one. Unlike stripPort, it only strips a port made of digits, so that a
+// trailing param of the pattern is kept.
+// Eg. stripPatternPort("example.com:8080") returns "example.com" and
+// stripPatternPort("example.:tld") returns "example.:tld".
+func stripPatternPort(host string) string {
+	colon := strings.LastIndexByte(host, ':')
+	if colon <= 0 || colon == len(host)-1 {
+		return host
+	}
+	for _, c := range host[colon+1:] {
+		if c < '0' || c > '9' {
+			return host
+		}
+	}
+	return host[:colon]
+}
+
+// expandPath function returns all the paths described by the path with
+// optional parts. An optional part is enclosed in '[' and ']' and can be nested
+// in another one. The last param of the path followed by '?' is optional too,
+// together with the '/' before it. The paths with more optional parts present
+// come first.
+// Eg.
+// expandPath("/posts/:page?")
+// returns "/posts/:page", "/posts"
+// expandPath("/users[/:id[/edit]]")
+// returns "/users/:id/edit", "/users/:id", "/users"
+func expandPath(path string) ([]string, error) {
+	for start := 0; start < len(path); start++ {
+		if path[start] != ':' && path[start] != '*' {
+			continue
+		}
+		end := start + tokenEnd(path[start:])
+		if end != len(path)-1 || path[end] != '?' {
+			start = end - 1
+			continue
+		}
+		// the last param is optional, same as if it was enclosed in '[' and ']'
+		if start > 1 && path[start-1] == '/' {
+			start--
+		}
+		path = path[:start] + "[" + path[start:end] + "]"
+	}
+	return expandOptional(path)
+}
+
+// expandOptional function returns all the paths described by the path with
+// the optional parts enclosed in '[' and ']', see expandPath.
+func expandOptional(path string) ([]string, error) {
+	open, depth := -1, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case ':', '*':
+			// the constraint of the param can contain '[' and ']'
+			i += tokenEnd(path[i:]) - 1
+		case '?':
+			return nil, fmt.Errorf("%w: '?' at %d has to follow the last param",
+				ErrInvalidPath, i)
+		case '[':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case ']':
+			depth--
+			if depth < 0 || depth == 0 && i == open+1 {
+				return nil, fmt.Errorf("%w: unexpected ']' at %d",
+					ErrInvalidPath, i)
+			}
+			if depth > 0 {
+				continue
+			}
+			inners, err := expandOptional(path[open+1 : i])
+			if err != nil {
+				return nil, err
+			}
+			rests, err := expandOptional(path[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			var paths []string
+			for _, inner := range append(inners, "") {
+				for _, rest := range rests {
+					paths = append(paths, path[:open]+inner+rest)
+				}
+			}
+			return paths, nil
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("%w: unclosed '[' at %d", ErrInvalidPath, open)
+	}
+	return []string{path}, nil
+}
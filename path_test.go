@@ -0,0 +1,150 @@
+package gocelot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCleanPathReturnsCanonicalPath(t *testing.T) {
+	paths := map[string]string{
+		"": "/",
+		"/": "/",
+		"path": "/path",
+		"/path": "/path",
+		"/path/": "/path/",
+		"//path//to///file": "/path/to/file",
+		"/path/./to/../file/": "/path/file/",
+		"/../path/..": "/",
+		"/path/..//": "/",
+	}
+	for path, expected := range paths {
+		if cleanPath(path) != expected {
+			t.Error(path, cleanPath(path))
+		}
+	}
+}
+
+func TestToggleTrailingSlashAddsOrRemovesTrailingSlash(t *testing.T) {
+	if toggleTrailingSlash("/path") != "/path/" ||
+		toggleTrailingSlash("/path/") != "/path" ||
+		toggleTrailingSlash("/") != "" {
+
+		t.Fail()
+	}
+}
+
+func TestFillPathReplacesParamsWithValuesInOrder(t *testing.T) {
+	params := Params{{"id", "John", nil}, {"id", "2", nil},
+		{"rest", "a/B", nil}}
+	if fillPath("/users/:id/:id/*rest", params) != "/users/John/2/a/B" ||
+		fillPath("/users", params) != "/users" ||
+		fillPath("/:id/end/", params) != "/John/end/" {
+
+		t.Fail()
+	}
+}
+
+func TestFillPathReplacesEmbeddedAndConstrainedParams(t *testing.T) {
+	params := Params{{"name", "file", nil}, {"ext", "txt", nil}}
+	if fillPath("/files/:name<[a-z]+>.:ext|slug", params) !=
+		"/files/file.txt" || fillPath("/v:name/", params) != "/vfile/" {
+
+		t.Fail()
+	}
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExpandPathOfPathWithoutOptionalPartsReturnsPath(t *testing.T) {
+	paths, err := expandPath("/users/:id<[0-9]+>")
+	if err != nil || !equalPaths(paths, []string{"/users/:id<[0-9]+>"}) {
+		t.Fail()
+	}
+}
+
+func TestExpandPathOfOptionalLastParam(t *testing.T) {
+	for path, expanded := range map[string][]string{
+		"/posts/:page?": {"/posts/:page", "/posts"},
+		"/:page|int?": {"/:page|int", "/"},
+		"/v:version<[0-9]>?": {"/v:version<[0-9]>", "/v"},
+		"/files/*rest?": {"/files/*rest", "/files"},
+	} {
+		paths, err := expandPath(path)
+		if err != nil || !equalPaths(paths, expanded) {
+			t.Error(path, paths)
+		}
+	}
+}
+
+func TestExpandPathOfOptionalParts(t *testing.T) {
+	for path, expanded := range map[string][]string{
+		"/posts[/:page]": {"/posts/:page", "/posts"},
+		"/users[/:id[/edit]]": {"/users/:id/edit", "/users/:id", "/users"},
+		"/a[/b]/c[/d]": {"/a/b/c/d", "/a/b/c", "/a/c/d", "/a/c"},
+		"/:id<[0-9]>[.json]": {"/:id<[0-9]>.json", "/:id<[0-9]>"},
+	} {
+		paths, err := expandPath(path)
+		if err != nil || !equalPaths(paths, expanded) {
+			t.Error(path, paths)
+		}
+	}
+}
+
+func TestExpandPathRejectsMalformedOptionalParts(t *testing.T) {
+	for _, path := range []string{"/posts[/:page", "/posts]", "/posts[]",
+		"/posts?", "/posts/:page?/", "/[/:a?]", "/a[[/b]"} {
+
+		if _, err := expandPath(path); !errors.Is(err, ErrInvalidPath) {
+			t.Error(path)
+		}
+	}
+}
+
+func TestStripPortRemovesPortOfHost(t *testing.T) {
+	hosts := map[string]string{
+		"example.com": "example.com",
+		"example.com:8080": "example.com",
+		"[::1]": "[::1]",
+		"[::1]:8080": "[::1]",
+		"": "",
+	}
+	for host, stripped := range hosts {
+		if stripPort(host) != stripped {
+			t.Error(host)
+		}
+	}
+}
+
+func TestStripPatternPortRemovesPortButKeepsParams(t *testing.T) {
+	hosts := map[string]string{
+		"example.com": "example.com",
+		"example.com:8080": "example.com",
+		"[::1]:8080": "[::1]",
+		":tenant.example.com": ":tenant.example.com",
+		"example.:tld": "example.:tld",
+		"example.com:": "example.com:",
+	}
+	for host, stripped := range hosts {
+		if stripPatternPort(host) != stripped {
+			t.Error(host)
+		}
+	}
+}
+
+func TestEscapePathEncodesSegmentsKeepingSlashes(t *testing.T) {
+	if escapePath("/files/a?b c/d%e") != "/files/a%3Fb%20c/d%25e" ||
+		escapePath("/users/1") != "/users/1" {
+
+		t.Fail()
+	}
+}
@@ -0,0 +1,178 @@
+package gocelot
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// responseWriter wraps http.ResponseWriter and records whether the header or
+// the body have already been written.
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+// newResponseWriter returns a new responseWriter wrapping response.
+func newResponseWriter(response http.ResponseWriter) *responseWriter {
+	return &responseWriter{response, false}
+}
+
+// WriteHeader method records the write and passes the code to the wrapped
+// http.ResponseWriter.
+func (w *responseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write method records the write and passes the data to the wrapped
+// http.ResponseWriter.
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush method flushes the wrapped http.ResponseWriter if it is an
+// http.Flusher.
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		flusher.Flush()
+	}
+}
+
+// Hijack method hijacks the connection of the wrapped http.ResponseWriter and
+// records the write if it is an http.Hijacker. It returns
+// http.ErrNotSupported otherwise.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, buffer, err := hijacker.Hijack()
+		if err == nil {
+			w.written = true
+		}
+		return conn, buffer, err
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Push method initiates an HTTP/2 server push with the wrapped
+// http.ResponseWriter if it is an http.Pusher. It returns
+// http.ErrNotSupported otherwise.
+func (w *responseWriter) Push(target string, options *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, options)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap method returns the wrapped http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// headResponseWriter wraps http.ResponseWriter to serve HEAD requests with GET
+// handlers. It discards the body and counts its length, so that
+// Content-Length can be set once the handler returns. Writing the header is
+// delayed until then, unless the response is flushed earlier.
+type headResponseWriter struct {
+	http.ResponseWriter
+	code int
+	length int
+	wroteHeader bool
+}
+
+// newHeadResponseWriter returns a new headResponseWriter wrapping response.
+func newHeadResponseWriter(response http.ResponseWriter) *headResponseWriter {
+	return &headResponseWriter{response, 0, 0, false}
+}
+
+// WriteHeader method records the code to be written once the handler returns.
+// Informational codes are written straight away.
+func (w *headResponseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// Write method discards the data and adds its length to the body length.
+func (w *headResponseWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.length += len(data)
+	return len(data), nil
+}
+
+// Flush method writes the header without Content-Length, since the length of
+// the body isn't known yet, and flushes the wrapped http.ResponseWriter if it
+// is an http.Flusher.
+func (w *headResponseWriter) Flush() {
+	w.writeHeader(false)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack method hijacks the connection of the wrapped http.ResponseWriter if
+// it is an http.Hijacker, so that the header is no longer written once the
+// handler returns. It returns http.ErrNotSupported otherwise.
+func (w *headResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, buffer, err := hijacker.Hijack()
+		if err == nil {
+			w.wroteHeader = true
+		}
+		return conn, buffer, err
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Push method initiates an HTTP/2 server push with the wrapped
+// http.ResponseWriter if it is an http.Pusher. It returns
+// http.ErrNotSupported otherwise.
+func (w *headResponseWriter) Push(target string,
+	options *http.PushOptions) error {
+
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, options)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap method returns the wrapped http.ResponseWriter so that
+// http.ResponseController can reach it.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish method writes the header with Content-Length matching the discarded
+// body, unless the handler has set it or the header was already written.
+func (w *headResponseWriter) finish() {
+	w.writeHeader(true)
+}
+
+// writeHeader method writes the recorded code to the wrapped
+// http.ResponseWriter if it hasn't been written yet. If setLength is true,
+// Content-Length is set for the codes which allow a body.
+func (w *headResponseWriter) writeHeader(setLength bool) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	header := w.ResponseWriter.Header()
+	if setLength && w.code != http.StatusNoContent &&
+		w.code != http.StatusNotModified && header.Get("Content-Length") == "" {
+
+		header.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
@@ -0,0 +1,173 @@
+package gocelot
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// hijackRecorder is an httptest.ResponseRecorder which can be hijacked and
+// can push, recording the calls.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	pushed string
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func (r *hijackRecorder) Push(target string, _ *http.PushOptions) error {
+	r.pushed = target
+	return nil
+}
+
+func TestNewResponseWriterIsNotWritten(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newResponseWriter(recorder)
+	if writer.written || writer.Unwrap() != recorder {
+		t.Fail()
+	}
+}
+
+func TestWriteHeaderMarksResponseWriterAsWritten(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newResponseWriter(recorder)
+	writer.WriteHeader(201)
+	if !writer.written || recorder.Code != 201 {
+		t.Fail()
+	}
+}
+
+func TestWriteMarksResponseWriterAsWritten(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newResponseWriter(recorder)
+	writer.Write([]byte("body"))
+	if !writer.written || recorder.Body.String() != "body" {
+		t.Fail()
+	}
+}
+
+func TestFlushMarksResponseWriterAsWritten(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newResponseWriter(recorder)
+	writer.Flush()
+	if !writer.written || !recorder.Flushed {
+		t.Fail()
+	}
+}
+
+func TestHijackMarksResponseWriterAsWritten(t *testing.T) {
+	recorder := &hijackRecorder{httptest.NewRecorder(), false, ""}
+	writer := newResponseWriter(recorder)
+	if _, _, err := writer.Hijack(); err != nil || !writer.written ||
+		!recorder.hijacked {
+
+		t.Fail()
+	}
+}
+
+func TestPushIsPassedToTheWrappedResponseWriter(t *testing.T) {
+	recorder := &hijackRecorder{httptest.NewRecorder(), false, ""}
+	writer := newResponseWriter(recorder)
+	err := writer.Push("/style.css", nil)
+	if err != nil || recorder.pushed != "/style.css" {
+		t.Fail()
+	}
+}
+
+func TestHijackAndPushAreNotSupportedWithoutWrappedSupport(t *testing.T) {
+	writer := newResponseWriter(httptest.NewRecorder())
+	_, _, err := writer.Hijack()
+	if !errors.Is(err, http.ErrNotSupported) || writer.written ||
+		!errors.Is(writer.Push("/style.css", nil), http.ErrNotSupported) {
+
+		t.Fail()
+	}
+	head := newHeadResponseWriter(httptest.NewRecorder())
+	_, _, err = head.Hijack()
+	if !errors.Is(err, http.ErrNotSupported) ||
+		!errors.Is(head.Push("/style.css", nil), http.ErrNotSupported) {
+
+		t.Fail()
+	}
+}
+
+func TestHeadResponseWriterDoesNotWriteHeaderAfterHijack(t *testing.T) {
+	recorder := &hijackRecorder{httptest.NewRecorder(), false, ""}
+	writer := newHeadResponseWriter(recorder)
+	_, _, err := writer.Hijack()
+	writer.Push("/style.css", nil)
+	writer.finish()
+	if err != nil || !recorder.hijacked || recorder.pushed != "/style.css" ||
+		recorder.Header().Get("Content-Length") != "" {
+
+		t.Fail()
+	}
+}
+
+func TestHeadResponseWriterDiscardsBodyAndSetsContentLength(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := newHeadResponseWriter(recorder)
+	writer.Write([]byte("some"))
+	writer.Write([]byte(" body"))
+	if recorder.Code != 200 || recorder.Header().Get("Content-Length") != "" {
+		t.Fail()
+	}
+	writer.finish()
+	if recorder.Code != 200 || recorder.Body.Len() != 0 ||
+		recorder.Header().Get("Content-Length") != "9" {
+
+		t.Fail()
+	}
+}
+
+func TestHeadResponseWriterKeepsCodeAndContentLengthOfTheHandler(
+	t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	writer := newHeadResponseWriter(recorder)
+	writer.Header().Set("Content-Length", "100")
+	writer.WriteHeader(201)
+	writer.WriteHeader(500)
+	writer.Write([]byte("body"))
+	writer.finish()
+	if recorder.Code != 201 ||
+		recorder.Header().Get("Content-Length") != "100" {
+
+		t.Fail()
+	}
+}
+
+func TestHeadResponseWriterDoesNotSetContentLengthForNoContent(
+	t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	writer := newHeadResponseWriter(recorder)
+	writer.WriteHeader(204)
+	writer.finish()
+	if recorder.Code != 204 || recorder.Header().Get("Content-Length") != "" {
+		t.Fail()
+	}
+}
+
+func TestHeadResponseWriterFlushWritesHeaderWithoutContentLength(
+	t *testing.T) {
+
+	recorder := httptest.NewRecorder()
+	writer := newHeadResponseWriter(recorder)
+	writer.Write([]byte("body"))
+	writer.Flush()
+	writer.Write([]byte("more body"))
+	writer.finish()
+	if !recorder.Flushed || recorder.Body.Len() != 0 ||
+		recorder.Header().Get("Content-Length") != "" {
+
+		t.Fail()
+	}
+}
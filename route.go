@@ -0,0 +1,189 @@
+package gocelot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Route is a route added to the router. It can be named to build its URL, see
+// Router.URL.
+// The sequences hold the nodes of the paths of the route with and without the
+// optional parts, in the order of expandPath.
+type Route struct {
+	router *Router
+	method string
+	path string
+	sequences []*node
+}
+
+// newRoute function returns the route of the router for the method with the
+// path expanded to the paths.
+func newRoute(router *Router, method, path string, paths []string) *Route {
+	sequences := make([]*node, len(paths))
+	for i, expanded := range paths {
+		sequences[i], _ = nodeSeq(expanded, router.converters)
+	}
+	return &Route{router, method, path, sequences}
+}
+
+// Name method names the route, so that its URL can be built by Router.URL.
+// It panics if another route of the router already has the name.
+func (route *Route) Name(name string) *Route {
+	router := route.router
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	if named, ok := router.named[name]; ok && named != route {
+		panic("gocelot: duplicate route name " + name)
+	}
+	if router.named == nil {
+		router.named = make(map[string]*Route)
+	}
+	router.named[name] = route
+	return route
+}
+
+// URL method returns the path of the route named name with the params replaced
+// with the values, given as key/value pairs. Eg. for the route "/users/:id"
+// named "user.show"
+// URL("user.show", "id", "42")
+// returns "/users/42".
+// The values are percent-encoded, a catch-all value keeps its '/'. If the path
+// has optional parts, the path using the most of the values is used and among
+// those the shortest one, so the optional parts without params are left out.
+// Eg. for "/users[/:id[/edit]]" URL returns "/users" without values and
+// "/users/42" with the id. The values of the params which aren't in the path
+// are ignored.
+// It returns an error wrapping ErrUnknownRoute if there is no route with the
+// name, ErrMissingParam if a param has no value or ErrInvalidParam if a value
+// can't be matched by its param, eg. it doesn't satisfy the constraint or it
+// is "..".
+func (r *Router) URL(name string, pairs ...string) (string, error) {
+	r.mutex.RLock()
+	route, ok := r.named[name]
+	r.mutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("gocelot: %s: %w", name, ErrUnknownRoute)
+	}
+	if len(pairs)%2 != 0 {
+		return "", fmt.Errorf("gocelot: %s: %w: %s has no value", name,
+			ErrMissingParam, pairs[len(pairs)-1])
+	}
+	values := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = pairs[i+1]
+	}
+	best, used := "", -1
+	var err error
+	for _, sequence := range route.sequences {
+		path, count, buildErr := buildPath(sequence, values)
+		if buildErr != nil && !errors.Is(buildErr, ErrMissingParam) {
+			return "", fmt.Errorf("gocelot: %s: %w", name, buildErr)
+		} else if buildErr != nil {
+			err = buildErr
+		} else if count > used || count == used && len(path) < len(best) {
+			best, used = path, count
+		}
+	}
+	if used < 0 {
+		return "", fmt.Errorf("gocelot: %s: %w", name, err)
+	}
+	return best, nil
+}
+
+// buildPath function returns the path of the sequence of nodes with the params
+// replaced with the percent-encoded values and the number of the params.
+// The values can't be "." or "..", nor can the segments of the catch-all
+// values, since such segments would be removed from the path by the clients.
+func buildPath(sequence *node, values map[string]string) (string, int,
+	error) {
+
+	var path strings.Builder
+	count := 0
+	for n := sequence; n != nil; n = n.following() {
+		if n.path[0] != ':' && n.path[0] != '*' {
+			path.WriteString(n.path)
+			continue
+		}
+		count++
+		name, _ := splitParam(n.path)
+		value, ok := values[name]
+		if !ok {
+			return "", 0, fmt.Errorf("%w: %s", ErrMissingParam, name)
+		}
+		if n.path[0] == '*' {
+			segments := strings.Split(value, "/")
+			for i, segment := range segments {
+				if isDotSegment(segment) {
+					return "", 0, fmt.Errorf("%w: %s=%q", ErrInvalidParam, name,
+						value)
+				}
+				segments[i] = url.PathEscape(segment)
+			}
+			path.WriteString(strings.Join(segments, "/"))
+			continue
+		}
+		if _, ok := n.convert(value); !ok || value == "" ||
+			strings.Contains(value, "/") || isDotSegment(value) {
+
+			return "", 0, fmt.Errorf("%w: %s=%q", ErrInvalidParam, name, value)
+		}
+		path.WriteString(url.PathEscape(value))
+	}
+	return path.String(), count, nil
+}
+
+// isDotSegment function returns true if the segment is "." or "..".
+func isDotSegment(segment string) bool {
+	return segment == "." || segment == ".."
+}
+
+// following method returns the node following the node of a sequence, see
+// nodeSeq, or nil if it is the last one.
+func (n *node) following() *node {
+	if len(n.next) == 0 {
+		return nil
+	}
+	return n.next[0]
+}
+
+// RouteInfo describes a route of the router, see Router.Routes.
+type RouteInfo struct {
+	Method string
+	Pattern string
+	Handler http.Handler
+}
+
+// Walk method calls fn for every method/handler of every path of the tree,
+// with the full pattern of the path, eg. "/users/:id|int". The paths are
+// walked in the order of the tree, ie. the order they are matched in, and the
+// handlers of a path in the order they were added. The paths with optional
+// parts are walked once for each path they were expanded to. The handlers are
+// wrapped with their middleware. The routes of the hosts are walked by their
+// routers, see Host.
+// Walk stops and returns the error if fn returns one.
+func (r *Router) Walk(fn func(method, pattern string,
+	handler http.Handler) error) error {
+
+	var err error
+	r.tree.Load().walk("", func(path string, n *node) {
+		for _, handlerNode := range n.handlers.nodes {
+			if err == nil {
+				err = fn(handlerNode.method, path, handlerNode.handler)
+			}
+		}
+	})
+	return err
+}
+
+// Routes method returns all the routes of the tree in the order of Walk.
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	r.Walk(func(method, pattern string, handler http.Handler) error {
+		routes = append(routes, RouteInfo{method, pattern, handler})
+		return nil
+	})
+	return routes
+}
@@ -0,0 +1,56 @@
+package gocelot
+
+import (
+	"errors"
+)
+
+// Errors describing why a route can't be added to the router.
+// They are wrapped in RouteError, use errors.Is to check for them.
+var (
+	// ErrInvalidPath is used for paths which are malformed, eg. don't start
+	// with '/', have an empty param name or a catch-all which is not the last
+	// segment of the path.
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrParamConflict is used if a different param is already stored in the
+	// tree at the same position of the path.
+	ErrParamConflict = errors.New("conflicting params")
+	// ErrDuplicateRoute is used if a handler for the path/method already
+	// exists.
+	ErrDuplicateRoute = errors.New("duplicate route")
+)
+
+// Errors describing why the URL of a route can't be built, see Router.URL, or
+// why a route can't be removed, see Router.Remove.
+var (
+	// ErrUnknownRoute is used if there is no route with the name or no
+	// handler for the path/method to remove or replace.
+	ErrUnknownRoute = errors.New("unknown route")
+	// ErrMissingParam is used if a param of the path has no value.
+	ErrMissingParam = errors.New("missing param")
+	// ErrInvalidParam is used if the value of a param can't be matched by the
+	// param, eg. it doesn't satisfy its constraint.
+	ErrInvalidParam = errors.New("invalid param")
+)
+
+// RouteError is returned when a route can't be added to the router.
+// It holds the method and the path of the route and the reason why it can't be
+// added.
+type RouteError struct {
+	Method string
+	Path string
+	Err error
+}
+
+// Error method returns the description of the error.
+func (e *RouteError) Error() string {
+	route := e.Path
+	if e.Method != "" {
+		route = e.Method + " " + e.Path
+	}
+	return "gocelot: " + route + ": " + e.Err.Error()
+}
+
+// Unwrap method returns the reason why the route can't be added.
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,29 @@
+package gocelot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRouteErrorDescribesTheRoute(t *testing.T) {
+	err := &RouteError{"GET", "/path", ErrDuplicateRoute}
+	if err.Error() != "gocelot: GET /path: duplicate route" {
+		t.Fail()
+	}
+}
+
+func TestRouteErrorWithoutMethodDescribesThePath(t *testing.T) {
+	err := &RouteError{"", "path", ErrInvalidPath}
+	if err.Error() != "gocelot: path: invalid path" {
+		t.Fail()
+	}
+}
+
+func TestRouteErrorUnwrapsToTheReason(t *testing.T) {
+	reason := fmt.Errorf("%w: :a and :b", ErrParamConflict)
+	var err error = &RouteError{"GET", "/:a", reason}
+	if !errors.Is(err, ErrParamConflict) || errors.Unwrap(err) != reason {
+		t.Fail()
+	}
+}
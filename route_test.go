@@ -0,0 +1,195 @@
+package gocelot
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestURLReplacesParamsWithValues(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id|int/files/:name.:ext", emptyHandler).
+		Name("user.file")
+	url, err := router.URL("user.file", "id", "42", "name", "cv",
+		"ext", "pdf")
+	if err != nil || url != "/users/42/files/cv.pdf" {
+		t.Fail()
+	}
+}
+
+func TestURLPercentEncodesValues(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/search/:query/*path", emptyHandler).Name("search")
+	url, err := router.URL("search", "query", "a b?", "path", "c d/e%f")
+	if err != nil || url != "/search/a%20b%3F/c%20d/e%25f" {
+		t.Error(url, err)
+	}
+}
+
+func TestURLUsesShortestPathWithMostParams(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/posts[/:page|int]", emptyHandler).Name("posts")
+	url, err := router.URL("posts", "page", "2")
+	if err != nil || url != "/posts/2" {
+		t.Fail()
+	}
+	url, err = router.URL("posts")
+	if err != nil || url != "/posts" {
+		t.Fail()
+	}
+}
+
+func TestURLLeavesOutOptionalPartsWithoutParams(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/posts[/all]", emptyHandler).Name("posts")
+	router.Handle("GET", "/users[/:id[/edit]]", emptyHandler).Name("users")
+	if url, err := router.URL("posts"); err != nil || url != "/posts" {
+		t.Fail()
+	}
+	if url, err := router.URL("users"); err != nil || url != "/users" {
+		t.Fail()
+	}
+	url, err := router.URL("users", "id", "1")
+	if err != nil || url != "/users/1" {
+		t.Fail()
+	}
+}
+
+func TestURLOfUnknownRouteReturnsError(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users", emptyHandler)
+	if _, err := router.URL("users"); !errors.Is(err, ErrUnknownRoute) {
+		t.Fail()
+	}
+}
+
+func TestURLWithMissingParamReturnsError(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id", emptyHandler).Name("user")
+	if _, err := router.URL("user"); !errors.Is(err, ErrMissingParam) {
+		t.Fail()
+	}
+	if _, err := router.URL("user", "id"); !errors.Is(err, ErrMissingParam) {
+		t.Fail()
+	}
+}
+
+func TestURLWithInvalidParamReturnsError(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id<[0-9]+>", emptyHandler).Name("user")
+	router.Handle("GET", "/posts[/:page|int]", emptyHandler).Name("posts")
+	for _, value := range []string{"a", "", "1/2"} {
+		if _, err := router.URL("user", "id", value); !errors.Is(err,
+			ErrInvalidParam) {
+
+			t.Error(value)
+		}
+	}
+	if _, err := router.URL("posts", "page", "x"); !errors.Is(err,
+		ErrInvalidParam) {
+
+		t.Fail()
+	}
+}
+
+func TestURLWithDotSegmentsReturnsError(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:name", emptyHandler).Name("user")
+	router.Handle("GET", "/files/*path", emptyHandler).Name("file")
+	for _, value := range []string{".", ".."} {
+		if _, err := router.URL("user", "name", value); !errors.Is(err,
+			ErrInvalidParam) {
+
+			t.Error(value)
+		}
+	}
+	for _, value := range []string{".", "..", "a/../b", "a/.", "./a"} {
+		if _, err := router.URL("file", "path", value); !errors.Is(err,
+			ErrInvalidParam) {
+
+			t.Error(value)
+		}
+	}
+	url, err := router.URL("file", "path", "a/.b/..c")
+	if err != nil || url != "/files/a/.b/..c" {
+		t.Fail()
+	}
+}
+
+func TestURLOfGroupRouteHasPrefix(t *testing.T) {
+	router := New()
+	router.Group("/admin").Handle("GET", "/users/:id", emptyHandler).
+		Name("admin.user")
+	if url, _ := router.URL("admin.user", "id", "1"); url != "/admin/users/1" {
+		t.Fail()
+	}
+}
+
+func TestNamePanicsIfNameIsTaken(t *testing.T) {
+	router := New()
+	route := router.Handle("GET", "/users", emptyHandler).Name("users")
+	route.Name("users")
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	router.Handle("POST", "/users", emptyHandler).Name("users")
+}
+
+func TestWalkCallsFnForEveryMethodOfEveryPath(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id|int", emptyHandler)
+	router.Handle("GET", "/users/new", differentEmptyHandler)
+	router.Handle("POST", "/users/new", emptyHandler, Query("a"))
+	router.Handle("GET", "/posts[/:page]", emptyHandler)
+	var walked []string
+	err := router.Walk(func(method, pattern string, h http.Handler) error {
+		walked = append(walked, method+" "+pattern)
+		return nil
+	})
+	expected := []string{"GET /users/new", "POST /users/new",
+		"GET /users/:id|int", "GET /posts", "GET /posts/:page"}
+	if err != nil || len(walked) != len(expected) {
+		t.Fatal(walked)
+	}
+	for i := range expected {
+		if walked[i] != expected[i] {
+			t.Error(walked)
+		}
+	}
+}
+
+func TestWalkStopsAtFirstError(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/a", emptyHandler)
+	router.Handle("GET", "/b", emptyHandler)
+	stop := errors.New("stop")
+	calls := 0
+	err := router.Walk(func(method, pattern string, h http.Handler) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fail()
+	}
+}
+
+func TestRoutesReturnsMethodsPatternsAndHandlers(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users", emptyHandler)
+	router.Handle("PUT", "/users/:id", differentEmptyHandler)
+	routes := router.Routes()
+	if len(routes) != 2 || routes[0] != (RouteInfo{"GET", "/users",
+		emptyHandler}) || routes[1] != (RouteInfo{"PUT", "/users/:id",
+		differentEmptyHandler}) {
+
+		t.Fail()
+	}
+}
+
+func TestRoutesOfEmptyRouterIsEmpty(t *testing.T) {
+	if len(New().Routes()) != 0 {
+		t.Fail()
+	}
+}
@@ -1,14 +1,19 @@
 // TODO:
-//  merging trees
-//  panic handler
 //  readme
 
 // Package gocelot provides a simple url router.
-// It supports url parameters and places them in http.request.Form field.
+// It supports url parameters and places them in the request context and path
+// values, see ParamsFromContext and http.Request.PathValue.
 package gocelot
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Router conforms to http.Handler interface.
@@ -17,51 +22,827 @@ import (
 // By default http.NotFound func is used.
 // MethodNotAllowed handler is used if there are handlers for a given path,
 // but no handler for the given method is found.
+// NotAcceptable handler is used if there are handlers for a given path/method,
+// but none of them produces a media type accepted by the request, see
+// Produces. By default 406 Not Acceptable is sent.
+// PanicHandler is used to recover from panics in handlers. It is called with
+// the value passed to panic. Since it is called before the panicking stack is
+// unwound, runtime/debug.Stack returns the stack trace of the panic.
+// If PanicHandler doesn't write the response and the response hasn't been
+// written yet, the router responds with 500 Internal Server Error.
+// By default panics are not recovered.
+// FormParams makes the router also put the url parameters in request.Form.
+// Note that net/http doesn't parse the query and the body into request.Form
+// if it is already set.
+// Router reuses Params between requests, so they mustn't be used after the
+// handler returns. Copy them if they are needed for longer.
+// If HandleOPTIONS is set, OPTIONS requests for the paths without an OPTIONS
+// handler are answered automatically with the Allow header listing the methods
+// of the path. GlobalOPTIONS handler, if set, is then used to write the rest of
+// the response, eg. CORS headers. Otherwise 204 No Content is sent.
+// The Allow header is also set before the MethodNotAllowed handler is used.
+// If HandleHEAD is set, HEAD requests for the paths without a HEAD handler are
+// served by the GET handler of the path. The body it writes is discarded and
+// only used to set Content-Length.
+// If RedirectTrailingSlash is set and there is no handler for the path/method,
+// but there is one for the path with the trailing '/' added or removed, the
+// request is redirected there. Eg. "/users/" is redirected to "/users".
+// If RedirectFixedPath is set and there is no handler for the path/method,
+// the path is cleaned, ie. the superfluous '/', './' and '../' elements are
+// removed. If there is a handler for the cleaned path, the request is
+// redirected there. Eg. "/users//1/../2" is redirected to "/users/2".
+// If CaseInsensitive is set and there is no handler for the path/method, the
+// static parts of the path are matched ignoring the case of ASCII letters. The
+// case of the param values is kept. Eg. "/Users/John" matches "/users/:name"
+// with name = "John".
+// If RedirectFixedCase is set, such requests are redirected to the path with
+// the case it was registered with instead, eg. "/Users/John" is redirected to
+// "/users/John".
+// The types of the typed params(':name|type') are looked up in the converters
+// of the router, see RegisterConverter.
+// The requests to the hosts added with Host are routed by the routers of the
+// hosts, all the other ones by the router itself.
+// The handlers of the routes are wrapped with the middleware added with Use
+// before the routes, see Use. If WrapFallbacks is set, the NotFound,
+// MethodNotAllowed and NotAcceptable handlers, the automatic OPTIONS answers
+// and the redirects are wrapped with the middleware too, eg. to add CORS
+// headers to them. It is set by New.
+// The routes added through a Group share the path prefix and the middleware of
+// the group.
+// The URLs of the named routes are built by URL, see Route.Name.
+// The routes of the router are listed by Walk and Routes and its tree is
+// written by DumpTree. The routes can be removed or their handlers replaced by
+// Remove and Replace, also while the router serves requests.
 type Router struct {
-	tree *node
+	tree atomic.Pointer[node]
+	hosts *node
+	parent *Router
+	hostParams int
+	methods []string
+	maxParams int
+	converters map[string]Converter
+	paramsPool sync.Pool
+	middleware []Middleware
+	named map[string]*Route
+	mutex sync.RWMutex
+	notFound http.Handler
+	methodNotAllowed http.Handler
+	notAcceptable http.Handler
+	automaticOPTIONS http.Handler
+	redirects http.Handler
 	NotFound http.Handler
 	MethodNotAllowed http.Handler
+	NotAcceptable http.Handler
+	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+	FormParams bool
+	HandleOPTIONS bool
+	GlobalOPTIONS http.Handler
+	HandleHEAD bool
+	RedirectTrailingSlash bool
+	RedirectFixedPath bool
+	CaseInsensitive bool
+	RedirectFixedCase bool
+	WrapFallbacks bool
 }
 
 // New function creates a new router with an empty tree(just tree root at '/')
-// and handlers set to nil.
+// and handlers set to nil. OPTIONS requests are answered automatically and the
+// fallback handlers are wrapped with the middleware.
+// The router knows the built-in int, uint, uuid, slug and date types.
 func New() *Router {
 	root := newNode()
 	root.path = "/"
-	return &Router{root, nil, nil}
+	converters := make(map[string]Converter, len(builtinConverters))
+	for name, converter := range builtinConverters {
+		converters[name] = converter
+	}
+	router := &Router{converters: converters, HandleOPTIONS: true,
+		WrapFallbacks: true}
+	router.tree.Store(root)
+	router.composeFallbacks()
+	return router
+}
+
+// Use method adds the middleware wrapping the handlers of the routes added to r
+// afterwards, the first middleware being the outermost one. The middleware of
+// the routes, see Middleware, is wrapped by it. The handlers are wrapped when
+// the routes are added, so the middleware has to be added before the routes.
+// The responses written by r itself are wrapped too, see WrapFallbacks.
+// The routers of the hosts have their own middleware, see Host.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+	r.composeFallbacks()
+}
+
+// composeFallbacks is a method which wraps the fallback handlers with the
+// middleware of r. The fallback handlers look up the NotFound,
+// MethodNotAllowed, NotAcceptable and GlobalOPTIONS handlers when they are
+// called, so that they can be changed after the middleware is added.
+func (r *Router) composeFallbacks() {
+	r.notFound = wrap(http.HandlerFunc(r.serveNotFound), r.middleware)
+	r.methodNotAllowed = wrap(http.HandlerFunc(r.serveMethodNotAllowed),
+		r.middleware)
+	r.notAcceptable = wrap(http.HandlerFunc(r.serveNotAcceptable),
+		r.middleware)
+	r.automaticOPTIONS = wrap(http.HandlerFunc(r.serveOPTIONS), r.middleware)
+	r.redirects = wrap(http.HandlerFunc(r.serveRedirect), r.middleware)
+}
+
+// RegisterConverter method adds the type with the given name, so that it can
+// be used by typed params, eg. ':id|name'. It replaces the converter of the
+// type if it already exists. The paths which use the type have to be added
+// after the converter is registered.
+func (r *Router) RegisterConverter(name string, converter Converter) {
+	r.converters[name] = converter
 }
 
 // Handle method adds the path to the tree and the handler for the method.
-// It accepts http.Handler as a handler
-func (r *Router) Handle(method, path string, handler http.Handler) {
-	r.tree.add(path).handle(method, handler)
+// It accepts http.Handler as a handler and the options of the route, eg.
+// Matchers. It returns the route, which can be named to build its URL, see
+// Route.Name.
+// It panics if the route can't be added, see TryHandle.
+func (r *Router) Handle(method, path string, handler http.Handler,
+	options ...Option) *Route {
+
+	route, err := r.addRoute(method, path, handler, options)
+	if err != nil {
+		panic(err)
+	}
+	return route
+}
+
+// TryHandle method adds the path to the tree and the handler for the method.
+// The path can have optional parts, eg. "/posts[/:page]" or "/posts/:page?",
+// in which case all the paths with and without them are added, see
+// expandPath.
+// If the options have Matchers, the handler is only used for the requests
+// satisfying all of them. The handlers with Matchers are tried in the order
+// they were added, before the handler without them.
+// If the options have Produces, the handler is only used for the requests
+// accepting one of its media types, see Produces.
+// The handler is wrapped with the middleware of r and then of the options.
+// It returns a *RouteError if the path is malformed, conflicts with a param
+// already stored in the tree or if a handler without Matchers for the
+// path/method and the media types already exists. If any of the paths can't
+// be added, none of them is, ie. r is left unchanged.
+func (r *Router) TryHandle(method, path string, handler http.Handler,
+	options ...Option) error {
+
+	_, err := r.addRoute(method, path, handler, options)
+	return err
+}
+
+// addRoute is a method which adds the route, see TryHandle, and returns it.
+func (r *Router) addRoute(method, path string, handler http.Handler,
+	options []Option) (*Route, error) {
+
+	paths, err := expandPath(path)
+	if err != nil {
+		return nil, &RouteError{method, path, err}
+	}
+	tree := r.tree.Load()
+	if len(paths) > 1 {
+		// a later path can fail after the earlier ones were added, so they are
+		// added to a copy of the tree, a single path is added atomically
+		tree = tree.clone()
+	}
+	if err := r.addPaths(tree, method, path, paths, handler,
+		options); err != nil {
+
+		return nil, err
+	}
+	r.tree.Store(tree)
+	return newRoute(r, method, path, paths), nil
+}
+
+// addPaths is a method which adds the paths the path expands to to the tree
+// with the handler for the method, see TryHandle. The tree is left partly
+// changed if any of the paths can't be added.
+func (r *Router) addPaths(tree *node, method, path string, paths []string,
+	handler http.Handler, options []Option) error {
+
+	routeOptions := newRouteOptions(options)
+	handler = wrap(wrap(handler, routeOptions.middleware), r.middleware)
+	for _, expanded := range paths {
+		if err := validatePath(expanded, r.converters); err != nil {
+			return &RouteError{method, path, err}
+		}
+	}
+	maxParams := 0
+	for _, expanded := range paths {
+		node, err := tree.add(expanded, r.converters)
+		if err != nil {
+			return &RouteError{method, path, err}
+		}
+		if !node.handle(method, handler, options...) {
+			return &RouteError{method, path, ErrDuplicateRoute}
+		}
+		if count := countParams(expanded); count > maxParams {
+			maxParams = count
+		}
+	}
+	r.setMaxParams(maxParams)
+	r.addMethod(method)
+	return nil
+}
+
+// addMethod is a method which adds the method to the methods of the router
+// unless it is already there.
+func (r *Router) addMethod(method string) {
+	for _, existing := range r.methods {
+		if existing == method {
+			return
+		}
+	}
+	r.methods = append(r.methods, method)
 }
 
 // HandleFunc method adds the path to the tree and the handler for the method.
 // It accepts func(http.ResponseWriter, *http.Request) as a handler
 func (r *Router) HandleFunc(method, path string,
-	handlerFunc func(http.ResponseWriter, *http.Request)) {
-	r.Handle(method, path, http.HandlerFunc(handlerFunc))
+	handlerFunc func(http.ResponseWriter, *http.Request),
+	options ...Option) *Route {
+
+	return r.Handle(method, path, http.HandlerFunc(handlerFunc), options...)
+}
+
+// Merge method adds all the paths and handlers of the router to r under the
+// path prefix. Eg. merging a router with "/users/:id" under "/api" adds
+// "/api/users/:id" to r.
+// If any of the merged routes can't be added, eg. its path is malformed,
+// conflicts with a param of r or its path/method already exists in r, Merge
+// returns a *RouteError and leaves r unchanged.
+// The types of the typed params are looked up in r, so they have to be
+// registered in r too. The merged handlers keep the middleware they were
+// wrapped with and are wrapped with the middleware of r too.
+func (r *Router) Merge(path string, router *Router) error {
+	if err := validatePath(path, r.converters); err != nil {
+		return &RouteError{"", path, err}
+	}
+	prefix := strings.TrimSuffix(path, "/")
+	// the routes are added one by one, r is restored if any of them fails
+	tree, methods, maxParams := r.tree.Load().clone(), r.methods, r.maxParams
+	var err error
+	router.tree.Load().walk(prefix, func(path string, n *node) {
+		for _, handlerNode := range n.handlers.nodes {
+			if err == nil {
+				err = r.TryHandle(handlerNode.method, path, handlerNode.handler,
+					handlerNode.options()...)
+			}
+		}
+	})
+	if err != nil {
+		r.tree.Store(tree)
+		r.methods, r.maxParams = methods, maxParams
+	}
+	return err
+}
+
+// Remove method removes the handlers for the method of the path, including the
+// ones with Matchers or Produces, and the names of the route. The path has to
+// be the same as it was added with, eg. "/users/:id|int". If it has optional
+// parts, the handlers of all the paths it expands to are removed. The nodes of
+// the tree left without handlers are removed and merged with their neighbours.
+// It returns a *RouteError if the path is malformed or there is no handler for
+// the method of any of the paths.
+// Remove can be called while r serves requests. The routes are removed from a
+// copy of the tree, which then replaces the tree at once, so each request is
+// served either with or without them.
+func (r *Router) Remove(method, path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	tree := r.tree.Load().clone()
+	if err := r.removeHandlers(tree, method, path); err != nil {
+		return err
+	}
+	tree.compact()
+	r.tree.Store(tree)
+	for name, route := range r.named {
+		if route.method == method && route.path == path {
+			delete(r.named, name)
+		}
+	}
+	return nil
+}
+
+// Replace method replaces the handlers for the method of the path with the
+// handler, see Remove. The handler is added with the options and wrapped with
+// the middleware of r like by TryHandle. The names of the route are kept.
+// It returns a *RouteError if the path is malformed or there is no handler for
+// the method of any of the paths, in which case r is left unchanged.
+// Like Remove, it can be called while r serves requests.
+func (r *Router) Replace(method, path string, handler http.Handler,
+	options ...Option) error {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	tree := r.tree.Load().clone()
+	if err := r.removeHandlers(tree, method, path); err != nil {
+		return err
+	}
+	paths, _ := expandPath(path)
+	if err := r.addPaths(tree, method, path, paths, handler,
+		options); err != nil {
+
+		return err
+	}
+	r.tree.Store(tree)
+	return nil
+}
+
+// removeHandlers is a method which removes the handlers for the method of all
+// the paths the path expands to from the tree. It checks that all of them have
+// a handler for the method before removing any.
+func (r *Router) removeHandlers(tree *node, method, path string) error {
+	paths, err := expandPath(path)
+	if err != nil {
+		return &RouteError{method, path, err}
+	}
+	nodes := make([]*node, len(paths))
+	for i, expanded := range paths {
+		if err := validatePath(expanded, r.converters); err != nil {
+			return &RouteError{method, path, err}
+		}
+		nodes[i] = tree.find(expanded)
+		if nodes[i] == nil || nodes[i].handlers == nil ||
+			nodes[i].handlers.index(method) < 0 {
+
+			return &RouteError{method, path, ErrUnknownRoute}
+		}
+	}
+	for _, node := range nodes {
+		node.handlers.remove(method)
+	}
+	return nil
+}
+
+// Host method returns the router of the requests to the host. The host can
+// have params like the paths, eg. ":tenant.example.com", which are put before
+// the params of the path. The host is matched ignoring the case and the port
+// of the request, the port of the host itself is ignored too. The requests to
+// the hosts without a router are routed by r.
+// The router of the host is created on the first call with a copy of the
+// settings of r, ie. the converters, the middleware added with Use, the
+// NotFound, MethodNotAllowed, NotAcceptable, PanicHandler and GlobalOPTIONS
+// handlers and the boolean options. The later changes of r don't change it,
+// except that the panics in its handlers are recovered by the PanicHandler of
+// r if it doesn't have its own. It panics if the host is malformed.
+func (r *Router) Host(host string) *Router {
+	if strings.Contains(host, "/") {
+		panic(&RouteError{"", host, fmt.Errorf("%w: host can't contain '/'",
+			ErrInvalidPath)})
+	}
+	// the port is ignored like the port of the request
+	host = stripPatternPort(host)
+	// the hosts are stored in a tree like the paths, with the leading '/'
+	if err := validatePath("/"+host, r.converters); err != nil {
+		panic(&RouteError{"", host, err})
+	}
+	if r.hosts == nil {
+		r.hosts = newNode()
+		r.hosts.path = "/"
+	}
+	node, err := r.hosts.add("/"+host, r.converters)
+	if err != nil {
+		panic(&RouteError{"", host, err})
+	}
+	if node.handlers != nil {
+		return node.handlers.get("").(*Router)
+	}
+	router := New()
+	router.inherit(r)
+	router.parent, router.hostParams = r, countParams(host)
+	r.setMaxParams(router.hostParams)
+	node.handle("", router)
+	return router
+}
+
+// inherit is a method which copies the settings of the parent to r, see Host.
+func (r *Router) inherit(parent *Router) {
+	for name, converter := range parent.converters {
+		r.converters[name] = converter
+	}
+	r.middleware = append([]Middleware(nil), parent.middleware...)
+	r.composeFallbacks()
+	r.NotFound = parent.NotFound
+	r.MethodNotAllowed = parent.MethodNotAllowed
+	r.NotAcceptable = parent.NotAcceptable
+	r.PanicHandler = parent.PanicHandler
+	r.FormParams = parent.FormParams
+	r.HandleOPTIONS = parent.HandleOPTIONS
+	r.GlobalOPTIONS = parent.GlobalOPTIONS
+	r.HandleHEAD = parent.HandleHEAD
+	r.RedirectTrailingSlash = parent.RedirectTrailingSlash
+	r.RedirectFixedPath = parent.RedirectFixedPath
+	r.CaseInsensitive = parent.CaseInsensitive
+	r.RedirectFixedCase = parent.RedirectFixedCase
+	r.WrapFallbacks = parent.WrapFallbacks
+}
+
+// route is a method which returns the router of the host and adds the params
+// of the host to params. It returns r if there is no router for the host.
+func (r *Router) route(host string, params *Params) *Router {
+	if r.hosts == nil {
+		return r
+	}
+	host = stripPort(host)
+	for _, next := range r.hosts.next {
+		handlers := next.lookup(host, "", nil, params, true)
+		if handlers != nil {
+			return handlers.get("").(*Router)
+		}
+	}
+	return r
+}
+
+// setMaxParams is a method which makes the params of r fit count params. If r
+// is the router of a host, the params of its parent have to fit them together
+// with the params of the host.
+func (r *Router) setMaxParams(count int) {
+	if count > r.maxParams {
+		r.maxParams = count
+	}
+	if r.parent != nil {
+		r.parent.setMaxParams(r.hostParams + count)
+	}
 }
 
 // Router implements http.Handler ServeHTTP method.
-// It routes the path/method to the correct handler or returns an error.
+// It routes the request to the router of its host, see Host, and the
+// path/method to the correct handler or returns an error.
 func (r *Router) ServeHTTP(response http.ResponseWriter,
 	request *http.Request) {
 
+	params := r.getParams()
+	defer r.putParams(params)
+	router := r.route(request.Host, params)
+	if router != r && router.PanicHandler == nil && r.PanicHandler != nil {
+		// the router of the host doesn't recover, r does it instead
+		writer := newResponseWriter(response)
+		response = writer
+		defer r.recover(writer, request)
+	}
+	router.serve(response, request, params)
+}
+
+// serve is a method which routes the path/method to the correct handler or
+// returns an error. The params can already hold the params of the host.
+func (r *Router) serve(response http.ResponseWriter, request *http.Request,
+	params *Params) {
+
+	if r.PanicHandler != nil {
+		writer := newResponseWriter(response)
+		response = writer
+		defer r.recover(writer, request)
+	}
 	path, method := request.URL.Path, request.Method
-	handler, pathFound := r.tree.get(path, method, request)
+	hostCount := len(*params)
+	// the tree is loaded once, so that the request is served by a single tree
+	// even if it is replaced meanwhile, see Remove
+	tree := r.tree.Load()
+	fold := false
+	handler, head, handlers := r.handler(tree, request, path, params, fold)
+	if handler == nil && (r.CaseInsensitive || r.RedirectFixedCase) {
+		fold = true
+		handler, head, handlers = r.handler(tree, request, path, params, fold)
+		if handler != nil && r.RedirectFixedCase {
+			target := r.canonicalPath(tree, handlers, (*params)[hostCount:])
+			if target != path {
+				r.redirect(response, request, target)
+				return
+			}
+		}
+	}
 	if handler != nil {
+		var headResponse *headResponseWriter
+		if head {
+			headResponse = newHeadResponseWriter(response)
+			response = headResponse
+		}
+		if len(*params) > 0 {
+			request = r.withParams(request, params)
+		}
 		handler.ServeHTTP(response, request)
+		if headResponse != nil {
+			// not deferred, panics have to reach the PanicHandler unwritten
+			headResponse.finish()
+		}
 		return
 	}
-	if pathFound && r.MethodNotAllowed != nil {
-		r.MethodNotAllowed.ServeHTTP(response, request)
+	if handlers != nil && method == http.MethodOptions && r.HandleOPTIONS {
+		response.Header().Set("Allow", r.allow(tree, request, fold))
+		r.fallback(r.automaticOPTIONS, r.serveOPTIONS).ServeHTTP(response,
+			request)
 		return
 	}
+	if method != http.MethodConnect && path != "/" {
+		if target := r.redirectPath(tree, request, params); target != "" {
+			r.redirect(response, request, target)
+			return
+		}
+	}
+	if handlers != nil && r.MethodNotAllowed != nil {
+		response.Header().Set("Allow", r.allow(tree, request, fold))
+		r.fallback(r.methodNotAllowed, r.serveMethodNotAllowed).ServeHTTP(
+			response, request)
+		return
+	}
+	r.fallback(r.notFound, r.serveNotFound).ServeHTTP(response, request)
+}
+
+// handler is a method which returns the handler of the tree for the path and
+// the method of the request if one exists and the handlers of the path or nil
+// if the path doesn't exist. The handler has to match the request, see Matcher.
+// If HandleHEAD is set, the GET handler is returned for HEAD requests without
+// a HEAD handler, in which case head is true.
+// If fold is true, the static parts of the path are matched ignoring the case
+// of ASCII letters.
+func (r *Router) handler(tree *node, request *http.Request, path string,
+	params *Params, fold bool) (handler http.Handler, head bool,
+	handlers *handlerArray) {
+
+	handler, handlers = r.match(tree, request, path, request.Method, params,
+		fold)
+	if handler == nil && handlers != nil &&
+		request.Method == http.MethodHead && r.HandleHEAD {
+
+		handler, _ = r.match(tree, request, path, http.MethodGet, params, fold)
+		head = handler != nil
+	}
+	return handler, head, handlers
+}
+
+// match is a method which returns the handler of the tree for the path/method
+// matching the request if one exists and the handlers of the path, see
+// node.get.
+// The NotAcceptable handler is returned if no node has a handler matching the
+// request and the handlers for the method of the first node with them don't
+// produce a media type accepted by the request.
+func (r *Router) match(tree *node, request *http.Request, path,
+	method string, params *Params, fold bool) (http.Handler, *handlerArray) {
+
+	count := len(*params)
+	handler, handlers := tree.get(path, method, request, params, fold)
+	if handler == nil && handlers != nil {
+		if _, acceptable := handlers.match(method, request); !acceptable {
+			handler = r.fallback(r.notAcceptable, r.serveNotAcceptable)
+		}
+	}
+	if handler == nil {
+		*params = (*params)[:count]
+	}
+	return handler, handlers
+}
+
+// fallback is a method which returns the fallback handler wrapped with the
+// middleware if WrapFallbacks is set or the handler itself otherwise.
+func (r *Router) fallback(wrapped http.Handler,
+	handler http.HandlerFunc) http.Handler {
+
+	if r.WrapFallbacks && wrapped != nil {
+		return wrapped
+	}
+	return handler
+}
+
+// serveNotFound is a method which serves the request with the NotFound handler
+// or http.NotFound if it isn't set.
+func (r *Router) serveNotFound(response http.ResponseWriter,
+	request *http.Request) {
+
 	if r.NotFound != nil {
 		r.NotFound.ServeHTTP(response, request)
 		return
 	}
 	http.NotFound(response, request)
 }
+
+// serveMethodNotAllowed is a method which serves the request with the
+// MethodNotAllowed handler or the NotFound one if it isn't set.
+func (r *Router) serveMethodNotAllowed(response http.ResponseWriter,
+	request *http.Request) {
+
+	if r.MethodNotAllowed != nil {
+		r.MethodNotAllowed.ServeHTTP(response, request)
+		return
+	}
+	r.serveNotFound(response, request)
+}
+
+// serveOPTIONS is a method which answers the OPTIONS request with the
+// GlobalOPTIONS handler or with 204 No Content if it isn't set. The Allow
+// header is already set.
+func (r *Router) serveOPTIONS(response http.ResponseWriter,
+	request *http.Request) {
+
+	if r.GlobalOPTIONS != nil {
+		r.GlobalOPTIONS.ServeHTTP(response, request)
+		return
+	}
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// serveNotAcceptable is a method which serves the request with the
+// NotAcceptable handler or responds with 406 Not Acceptable if it isn't set.
+func (r *Router) serveNotAcceptable(response http.ResponseWriter,
+	request *http.Request) {
+
+	if r.NotAcceptable != nil {
+		r.NotAcceptable.ServeHTTP(response, request)
+		return
+	}
+	http.Error(response, http.StatusText(http.StatusNotAcceptable),
+		http.StatusNotAcceptable)
+}
+
+// canonicalPath is a method which returns the path of the tree matching the
+// handlers with the case of the static parts as it was registered and the
+// values of the params. Like the values, the path is decoded, so it has to be
+// encoded before it is sent to the client, see redirect.
+func (r *Router) canonicalPath(tree *node, handlers *handlerArray,
+	params Params) string {
+
+	var pattern string
+	tree.walk("", func(path string, n *node) {
+		if n.handlers == handlers {
+			pattern = path
+		}
+	})
+	return fillPath(pattern, params)
+}
+
+// redirectPath is a method which returns the path the request should be
+// redirected to or "" if there is none.
+// If RedirectTrailingSlash is set, it is the path with the trailing '/' added
+// or removed. If RedirectFixedPath is set, it is the cleaned path, with the
+// trailing '/' fixed too if RedirectTrailingSlash is set.
+// If CaseInsensitive or RedirectFixedCase are set, the case is fixed too.
+// The returned path has a handler of the tree for the method of the request.
+func (r *Router) redirectPath(tree *node, request *http.Request,
+	params *Params) string {
+
+	path := request.URL.Path
+	// params can already hold the params of the host
+	hostCount := len(*params)
+	var candidates [4]string
+	count := 0
+	if r.RedirectTrailingSlash {
+		candidates[count] = toggleTrailingSlash(path)
+		count++
+	}
+	if r.RedirectFixedPath {
+		fixedPath := cleanPath(path)
+		if fixedPath != path {
+			candidates[count] = fixedPath
+			count++
+		}
+		if r.RedirectTrailingSlash && fixedPath != "/" {
+			candidates[count] = toggleTrailingSlash(fixedPath)
+			count++
+		}
+	}
+	fold := r.CaseInsensitive || r.RedirectFixedCase
+	for _, candidate := range candidates[:count] {
+		if strings.HasPrefix(candidate, "//") {
+			// it would be redirecting to a different host
+			continue
+		}
+		handler, _, _ := r.handler(tree, request, candidate, params, false)
+		if handler != nil {
+			return candidate
+		}
+		if fold {
+			handler, _, handlers := r.handler(tree, request, candidate, params,
+				true)
+			if handler != nil {
+				return r.canonicalPath(tree, handlers, (*params)[hostCount:])
+			}
+		}
+	}
+	return ""
+}
+
+// redirectKey is the type of the key under which the path the request is
+// redirected to is stored in the request context, see redirect.
+type redirectKey struct{}
+
+// redirect is a method which redirects the request to the decoded path, see
+// serveRedirect.
+func (r *Router) redirect(response http.ResponseWriter,
+	request *http.Request, path string) {
+
+	ctx := context.WithValue(request.Context(), redirectKey{}, path)
+	r.fallback(r.redirects, r.serveRedirect).ServeHTTP(response,
+		request.WithContext(ctx))
+}
+
+// serveRedirect is a method which redirects the request to the decoded path
+// stored in its context keeping the query. The path is percent-encoded again,
+// see escapePath. GET and HEAD requests are redirected with 301 Moved
+// Permanently, the other ones with 308 Permanent Redirect so that the method
+// and the body are kept.
+func (r *Router) serveRedirect(response http.ResponseWriter,
+	request *http.Request) {
+
+	path, _ := request.Context().Value(redirectKey{}).(string)
+	code := http.StatusPermanentRedirect
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	path = escapePath(path)
+	if request.URL.RawQuery != "" {
+		path += "?" + request.URL.RawQuery
+	}
+	http.Redirect(response, request, path, code)
+}
+
+// allow is a method which returns the value of the Allow header for the
+// request, ie. the comma separated methods which have handlers in the tree for
+// its path matching the request. Since different nodes can match the path for
+// different methods, every method of the router is looked up.
+// HEAD and OPTIONS are included if they are answered automatically.
+func (r *Router) allow(tree *node, request *http.Request, fold bool) string {
+	params := r.getParams()
+	defer r.putParams(params)
+	var methods []string
+	get, head, options := false, false, false
+	for _, method := range r.methods {
+		handler, _ := r.match(tree, request, request.URL.Path, method, params,
+			fold)
+		if handler != nil {
+			methods = append(methods, method)
+			get = get || method == http.MethodGet
+			head = head || method == http.MethodHead
+			options = options || method == http.MethodOptions
+		}
+		*params = (*params)[:0]
+	}
+	if r.HandleHEAD && get && !head {
+		methods = append(methods, http.MethodHead)
+	}
+	if r.HandleOPTIONS && !options {
+		methods = append(methods, http.MethodOptions)
+	}
+	return strings.Join(methods, ", ")
+}
+
+// getParams is a method which returns empty Params from the pool. Their
+// capacity fits the params of any registered path, so adding the params
+// during the lookup doesn't allocate.
+func (r *Router) getParams() *Params {
+	params, _ := r.paramsPool.Get().(*Params)
+	if params == nil || cap(*params) < r.maxParams {
+		newParams := make(Params, 0, r.maxParams)
+		return &newParams
+	}
+	return params
+}
+
+// putParams is a method which empties the params and puts them back in the
+// pool.
+func (r *Router) putParams(params *Params) {
+	*params = (*params)[:0]
+	r.paramsPool.Put(params)
+}
+
+// withParams is a method which returns a shallow copy of the request with the
+// params stored in its context and path values. If FormParams is set, the
+// params are also added to request.Form.
+func (r *Router) withParams(request *http.Request,
+	params *Params) *http.Request {
+
+	ctx := context.WithValue(request.Context(), paramsKey{}, params)
+	request = request.WithContext(ctx)
+	// set in reverse so that PathValue returns the same value as Params.Get
+	for i := len(*params) - 1; i >= 0; i-- {
+		request.SetPathValue((*params)[i].Key, (*params)[i].Value)
+	}
+	if r.FormParams {
+		if request.Form == nil {
+			request.Form = url.Values{}
+		}
+		for _, param := range *params {
+			request.Form.Add(param.Key, param.Value)
+		}
+	}
+	return request
+}
+
+// recover is a method which recovers from a panic and passes the recovered
+// value to the PanicHandler. It responds with 500 Internal Server Error if
+// nothing has been written to the response.
+// http.ErrAbortHandler is not recovered as it is meant to abort the response.
+func (r *Router) recover(response *responseWriter, request *http.Request) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	r.PanicHandler(response, request, recovered)
+	if !response.written {
+		http.Error(response, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+	}
+}
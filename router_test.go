@@ -1,9 +1,15 @@
 package gocelot
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 	"net/http"
 	"net/http/httptest"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type emptyHandlerStruct struct {}
@@ -20,8 +26,9 @@ func (h *failHandlerStruct) ServeHTTP(response http.ResponseWriter, request *htt
 
 func TestNewCreatesRouterWithTreeSet(t *testing.T) {
 	router := New()
-	if router == nil || router.tree.path != "/" || router.NotFound != nil ||
-		router.MethodNotAllowed != nil {
+	if router == nil || router.tree.Load().path != "/" ||
+		router.NotFound != nil || router.MethodNotAllowed != nil ||
+		!router.HandleOPTIONS {
 		
 		t.Fail()
 	}
@@ -30,7 +37,7 @@ func TestNewCreatesRouterWithTreeSet(t *testing.T) {
 func TestHandleAddsPathAndHandlerToTheTree(t *testing.T) {
 	router := New()
 	router.Handle("GET", "/path", emptyHandler) 
-	root := router.tree
+	root := router.tree.Load()
 	if root.next == nil || len(root.next) != 1 || root.next[0].path != "path" ||
 		root.next[0].handlers.get("GET") != emptyHandler {
 
@@ -41,7 +48,7 @@ func TestHandleAddsPathAndHandlerToTheTree(t *testing.T) {
 func TestHandlerFuncCreatesHandlerAddsPathAndHandlerToTheTree(t *testing.T) {
 	router := New()
 	router.HandleFunc("GET", "/path", emptyHandler.ServeHTTP) 
-	root := router.tree
+	root := router.tree.Load()
 	if root.next == nil || len(root.next) != 1 || root.next[0].path != "path" ||
 		root.next[0].handlers.get("GET") == nil {
 
@@ -99,3 +106,1581 @@ func TestServeHTTPUsesHTTPNotFoundByDefaultIfNoPathFound(t *testing.T) {
 
 	router.ServeHTTP(response, request)
 }
+
+func TestHandlePanicsOnCatchAllWhichIsNotTheLastSegment(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	router := New()
+	router.Handle("GET", "/path/*rest/end", emptyHandler)
+}
+
+func TestServeHTTPUsesCatchAllHandler(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.HandleFunc("GET", "/static/*filepath", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte(request.PathValue("filepath")))
+	})
+	router.MethodNotAllowed = failHandler
+	router.NotFound = failHandler
+
+	request, _ := http.NewRequest("GET", "/static/css/main.css", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "css/main.css" {
+		t.Fail()
+	}
+}
+
+func TestMergeAddsRoutesUnderThePath(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/", emptyHandler)
+	other := New()
+	other.Handle("GET", "/", differentEmptyHandler)
+	other.Handle("POST", "/users/:id", differentEmptyHandler)
+	if err := router.Merge("/api/", other); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("POST", "/api/users/1", nil)
+	var params Params
+	handler, _ := router.tree.Load().get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != differentEmptyHandler || params.Get("id") != "1" {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/api/", nil)
+	params = nil
+	handler, _ = router.tree.Load().get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != differentEmptyHandler {
+		t.Fail()
+	}
+	request, _ = http.NewRequest("GET", "/", nil)
+	params = nil
+	handler, _ = router.tree.Load().get(request.URL.Path, request.Method,
+		request, &params, false)
+	if handler != emptyHandler {
+		t.Fail()
+	}
+}
+
+func TestMergeOfCollidingRoutesReturnsErrorAndChangesNothing(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/api/users", emptyHandler)
+	other := New()
+	other.Handle("GET", "/posts", differentEmptyHandler)
+	other.Handle("GET", "/users", differentEmptyHandler)
+	if err := router.Merge("/api", other); err == nil {
+		t.Fail()
+	}
+	tree := router.tree.Load()
+	if tree.find("/api/posts") != nil ||
+		tree.find("/api/users").handlers.get("GET") != emptyHandler {
+
+		t.Fail()
+	}
+
+	router = New()
+	router.Handle("GET", "/api/:id", emptyHandler)
+	other = New()
+	other.Handle("GET", "/a", differentEmptyHandler)
+	other.Handle("GET", "/:name", differentEmptyHandler)
+	if err := router.Merge("/api", other); !errors.Is(err, ErrParamConflict) {
+		t.Fail()
+	}
+	if router.tree.Load().find("/api/a") != nil || len(router.Routes()) != 1 {
+		t.Fail()
+	}
+}
+
+func TestMergeOfPathNotStartingWithSlashReturnsError(t *testing.T) {
+	if err := New().Merge("api", New()); err == nil {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPPassesPanicToPanicHandler(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		panic("oops")
+	})
+	var recovered interface{}
+	router.PanicHandler = func(response http.ResponseWriter,
+		request *http.Request, value interface{}) {
+
+		recovered = value
+		if !strings.Contains(string(debug.Stack()),
+			"TestServeHTTPPassesPanicToPanicHandler.func1(") {
+
+
+			t.Error("stack trace of the panic is not available")
+		}
+		response.WriteHeader(503)
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if recovered != "oops" || response.Code != 503 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRespondsWith500IfPanicHandlerDoesNotWrite(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		panic("oops")
+	})
+	router.PanicHandler = func(http.ResponseWriter, *http.Request,
+		interface{}) {}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 500 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotOverwriteResponseWrittenBeforePanic(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		response.WriteHeader(202)
+		panic("oops")
+	})
+	router.PanicHandler = func(http.ResponseWriter, *http.Request,
+		interface{}) {}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 202 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotRecoverErrAbortHandler(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		panic(http.ErrAbortHandler)
+	})
+	router.PanicHandler = func(http.ResponseWriter, *http.Request,
+		interface{}) {
+
+		t.Fail()
+	}
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Fail()
+		}
+	}()
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestTryHandleReturnsErrorForInvalidPath(t *testing.T) {
+	router := New()
+	for _, path := range []string{"path", "/:", "/*", "/:a:b", "/*a/b"} {
+		err := router.TryHandle("GET", path, emptyHandler)
+		if routeErr, ok := err.(*RouteError); !ok ||
+			!errors.Is(err, ErrInvalidPath) || routeErr.Method != "GET" ||
+			routeErr.Path != path {
+
+			t.Error(path, err)
+		}
+	}
+}
+
+func TestTryHandleReturnsErrorForDuplicateRoute(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/path", emptyHandler)
+	err := router.TryHandle("GET", "/path", differentEmptyHandler)
+	if !errors.Is(err, ErrDuplicateRoute) ||
+		router.tree.Load().find("/path").handlers.get("GET") != emptyHandler {
+
+		t.Fail()
+	}
+	if router.TryHandle("POST", "/path", differentEmptyHandler) != nil {
+		t.Fail()
+	}
+}
+
+func TestTryHandleReturnsErrorForConflictingParams(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id", emptyHandler)
+	err := router.TryHandle("GET", "/users/:name/posts", emptyHandler)
+	if !errors.Is(err, ErrParamConflict) {
+		t.Fail()
+	}
+}
+
+func TestHandlePanicsWithRouteError(t *testing.T) {
+	defer func() {
+		if err, ok := recover().(error); !ok ||
+			!errors.Is(err, ErrDuplicateRoute) {
+
+			t.Fail()
+		}
+	}()
+	router := New()
+	router.Handle("GET", "/path", emptyHandler)
+	router.Handle("GET", "/path", emptyHandler)
+}
+
+func TestServeHTTPPassesParamsThroughContextAndPathValues(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/users/:id", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		if params.Get("id") != "1" || request.PathValue("id") != "1" ||
+			request.Form != nil {
+
+			t.Fail()
+		}
+	})
+
+	request, _ := http.NewRequest("GET", "/users/1", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestServeHTTPDoesNotPreventParsingForm(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/users/:id", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		request.ParseForm()
+		if request.Form.Get("query") != "value" || request.Form.Has("id") {
+			t.Fail()
+		}
+	})
+
+	request, _ := http.NewRequest("GET", "/users/1?query=value", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestServeHTTPPutsParamsInFormIfFormParamsIsSet(t *testing.T) {
+	router := New()
+	router.FormParams = true
+	router.HandleFunc("GET", "/users/:id", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		if request.Form.Get("id") != "1" || request.PathValue("id") != "1" {
+			t.Fail()
+		}
+	})
+
+	request, _ := http.NewRequest("GET", "/users/1", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestTryHandleTracksMaximumNumberOfParams(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/:a/:b/*c", emptyHandler)
+	router.Handle("GET", "/path/:a", emptyHandler)
+	if router.maxParams != 3 || cap(*router.getParams()) != 3 {
+		t.Fail()
+	}
+}
+
+func TestLookupOfPathWithParamsDoesNotAllocate(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id/posts/:post", emptyHandler)
+	router.Handle("GET", "/static/*filepath", emptyHandler)
+	allocs := testing.AllocsPerRun(100, func() {
+		params := router.getParams()
+		tree := router.tree.Load()
+		tree.get("/users/1/posts/2", "GET", nil, params, false)
+		tree.get("/static/css/main.css", "GET", nil, params, false)
+		router.putParams(params)
+	})
+	if allocs != 0 {
+		t.Fail()
+	}
+}
+
+func TestPutParamsEmptiesParams(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id", emptyHandler)
+	params := router.getParams()
+	router.tree.Load().get("/users/1", "GET", nil, params, false)
+	router.putParams(params)
+	if len(*params) != 0 {
+		t.Fail()
+	}
+}
+
+func BenchmarkLookupOfPathWithParams(b *testing.B) {
+	router := New()
+	router.Handle("GET", "/users/:id/posts/:post", emptyHandler)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params := router.getParams()
+		router.tree.Load().get("/users/1/posts/2", "GET", nil, params, false)
+		router.putParams(params)
+	}
+}
+
+func BenchmarkServeHTTPOfPathWithParams(b *testing.B) {
+	router := New()
+	router.Handle("GET", "/users/:id/posts/:post", emptyHandler)
+	request, _ := http.NewRequest("GET", "/users/1/posts/2", nil)
+	response := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(response, request)
+	}
+}
+
+func TestServeHTTPPassesRepeatedParamsInPathOrder(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/path/:key/:key", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		if params.ByIndex(0) != "1" || params.ByIndex(1) != "2" ||
+			request.PathValue("key") != "1" {
+
+			t.Fail()
+		}
+	})
+
+	request, _ := http.NewRequest("GET", "/path/1/2", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestServeHTTPSetsAllowHeaderForMethodNotAllowed(t *testing.T) {
+	router := New()
+	router.Handle("POST", "/path", emptyHandler)
+	router.Handle("PUT", "/path", emptyHandler)
+	router.MethodNotAllowed = emptyHandler
+
+	request, _ := http.NewRequest("GET", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "POST, PUT, OPTIONS" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPAnswersOPTIONSAutomatically(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/path/:param", failHandler)
+	router.MethodNotAllowed = failHandler
+	router.NotFound = failHandler
+
+	request, _ := http.NewRequest("OPTIONS", "/path/value", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 204 ||
+		response.Header().Get("Allow") != "GET, OPTIONS" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPUsesGlobalOPTIONSHandler(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/path", emptyHandler)
+	router.GlobalOPTIONS = http.HandlerFunc(func(response http.ResponseWriter,
+		request *http.Request) {
+
+		response.Header().Set("Access-Control-Allow-Origin", "*")
+		response.WriteHeader(200)
+	})
+
+	request, _ := http.NewRequest("OPTIONS", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 200 ||
+		response.Header().Get("Allow") != "GET, OPTIONS" ||
+		response.Header().Get("Access-Control-Allow-Origin") != "*" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPPrefersRegisteredOPTIONSHandler(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/path", failHandler)
+	router.Handle("OPTIONS", "/path", emptyHandler)
+	router.GlobalOPTIONS = failHandler
+
+	request, _ := http.NewRequest("OPTIONS", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotAnswerOPTIONSIfHandleOPTIONSIsNotSet(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.HandleOPTIONS = false
+	router.Handle("GET", "/path", failHandler)
+	router.MethodNotAllowed = emptyHandler
+	router.GlobalOPTIONS = failHandler
+
+	request, _ := http.NewRequest("OPTIONS", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "GET" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPServesHEADWithGETHandlerIfHandleHEADIsSet(t *testing.T) {
+	router := New()
+	router.HandleHEAD = true
+	router.HandleFunc("GET", "/path/:param", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte(request.PathValue("param")))
+	})
+
+	request, _ := http.NewRequest("HEAD", "/path/value", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 200 || response.Body.Len() != 0 ||
+		response.Header().Get("Content-Length") != "5" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPPrefersRegisteredHEADHandler(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.HandleHEAD = true
+	router.Handle("GET", "/path", failHandler)
+	router.Handle("HEAD", "/path", emptyHandler)
+
+	request, _ := http.NewRequest("HEAD", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+}
+
+func TestServeHTTPDoesNotServeHEADIfHandleHEADIsNotSet(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/path", failHandler)
+	router.MethodNotAllowed = emptyHandler
+
+	request, _ := http.NewRequest("HEAD", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPIncludesHEADInAllowHeaderIfHandleHEADIsSet(t *testing.T) {
+	router := New()
+	router.HandleHEAD = true
+	router.Handle("GET", "/path", emptyHandler)
+	router.MethodNotAllowed = emptyHandler
+
+	request, _ := http.NewRequest("POST", "/path", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRespondsWith500IfGETHandlerServingHEADPanics(
+	t *testing.T) {
+
+	router := New()
+	router.HandleHEAD = true
+	router.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		response.Write([]byte("body"))
+		panic("oops")
+	})
+	router.PanicHandler = func(http.ResponseWriter, *http.Request,
+		interface{}) {}
+
+	request, _ := http.NewRequest("HEAD", "/", nil)
+	response := httptest.NewRecorder()
+
+	router.ServeHTTP(response, request)
+	if response.Code != 500 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsTrailingSlash(t *testing.T) {
+	router := New()
+	router.RedirectTrailingSlash = true
+	router.Handle("GET", "/users", emptyHandler)
+	router.Handle("POST", "/users/:id/", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/users/?page=2", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 ||
+		response.Header().Get("Location") != "/users?page=2" {
+
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("POST", "/users/1", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 308 ||
+		response.Header().Get("Location") != "/users/1/" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotRedirectTrailingSlashWithoutHandler(t *testing.T) {
+	router := New()
+	router.RedirectTrailingSlash = true
+	router.Handle("POST", "/users", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/users/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotRedirectTrailingSlashIfNotSet(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/users/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsFixedPath(t *testing.T) {
+	router := New()
+	router.RedirectFixedPath = true
+	router.Handle("GET", "/users/:id", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/users//1/../2", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 || response.Header().Get("Location") != "/users/2" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsFixedPathWithEscapedParams(t *testing.T) {
+	router := New()
+	router.RedirectFixedPath = true
+	router.Handle("GET", "/files/:name", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/files//a%3Fb%20c?d=e", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 ||
+		response.Header().Get("Location") != "/files/a%3Fb%20c?d=e" {
+
+		t.Fail()
+	}
+
+	// the decoded '/' separates the segments, so the param doesn't match
+	request, _ = http.NewRequest("GET", "/files//a%2Fb", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsFixedPathWithTrailingSlash(t *testing.T) {
+	router := New()
+	router.RedirectFixedPath = true
+	router.RedirectTrailingSlash = true
+	router.Handle("PUT", "/users/:id", emptyHandler)
+
+	request, _ := http.NewRequest("PUT", "/users/./2/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 308 || response.Header().Get("Location") != "/users/2" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPDoesNotRedirectToDifferentHost(t *testing.T) {
+	router := New()
+	router.RedirectFixedPath = true
+	router.RedirectTrailingSlash = true
+	router.Handle("GET", "/:a/:b", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.URL.Path = "//evil.com/"
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code == 301 &&
+		strings.HasPrefix(response.Header().Get("Location"), "//") {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPMatchesCaseInsensitivelyIfCaseInsensitiveIsSet(
+	t *testing.T) {
+
+	router := New()
+	router.CaseInsensitive = true
+	router.HandleFunc("GET", "/users/:name", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte(request.PathValue("name")))
+	})
+
+	request, _ := http.NewRequest("GET", "/Users/John", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 || response.Body.String() != "John" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPPrefersExactCaseMatch(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.CaseInsensitive = true
+	router.Handle("GET", "/path", failHandler)
+	router.Handle("GET", "/PATH", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/PATH", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+}
+
+func TestServeHTTPDoesNotMatchCaseInsensitivelyByDefault(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:name", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/Users/John", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsToRegisteredCaseIfRedirectFixedCaseIsSet(
+	t *testing.T) {
+
+	router := New()
+	router.RedirectFixedCase = true
+	router.Handle("GET", "/users/:name/*rest", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/USERS/John/Some/File?a=b", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 ||
+		response.Header().Get("Location") != "/users/John/Some/File?a=b" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsToRegisteredCaseWithEscapedParams(
+	t *testing.T) {
+
+	router := New()
+	router.RedirectFixedCase = true
+	router.Handle("GET", "/users/:name/*rest", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/USERS/a%3Fb/c%20d/e?f", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 ||
+		response.Header().Get("Location") != "/users/a%3Fb/c%20d/e?f" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRedirectsToRegisteredCaseWithTrailingSlash(
+	t *testing.T) {
+
+	router := New()
+	router.CaseInsensitive = true
+	router.RedirectTrailingSlash = true
+	router.Handle("POST", "/users/:name", emptyHandler)
+
+	request, _ := http.NewRequest("POST", "/Users/John/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 308 ||
+		response.Header().Get("Location") != "/users/John" {
+
+		t.Fail()
+	}
+}
+
+func TestServeHTTPServesConstrainedParamsBeforeOtherBranches(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/users/:id<[0-9]+>", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("id " + request.PathValue("id")))
+	})
+	router.HandleFunc("GET", "/users/:name", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("name " + request.PathValue("name")))
+	})
+
+	for path, body := range map[string]string{"/users/42": "id 42",
+		"/users/new": "name new"} {
+
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Body.String() != body {
+			t.Error(path)
+		}
+	}
+}
+
+func TestTryHandleReturnsErrorForInvalidConstraint(t *testing.T) {
+	router := New()
+	err := router.TryHandle("GET", "/users/:id<[0-9>", emptyHandler)
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPPassesTypedParamsToHandler(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/posts/:when|date/:id|int", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		id, _ := params.Int("id")
+		when, _ := params.Date("when")
+		response.Write([]byte(fmt.Sprint(when.Year(), id+1)))
+	})
+
+	request, _ := http.NewRequest("GET", "/posts/2020-01-02/41", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "2020 42" {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/posts/2020-01-02/abc", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestRegisterConverterAddsCustomType(t *testing.T) {
+	router := New()
+	router.RegisterConverter("even", func(value string) (interface{}, bool) {
+		i, err := strconv.Atoi(value)
+		return i, err == nil && i%2 == 0
+	})
+	router.Handle("GET", "/:n|even", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/2", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/3", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestTryHandleReturnsErrorForUnknownType(t *testing.T) {
+	router := New()
+	err := router.TryHandle("GET", "/:n|even", emptyHandler)
+	if !errors.Is(err, ErrInvalidPath) {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPServesParamsEmbeddedInSegments(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/api/v:version|int/files/:name.:ext", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		version, _ := params.Int("version")
+		response.Write([]byte(fmt.Sprint(version, " ",
+			request.PathValue("name"), " ", request.PathValue("ext"))))
+	})
+
+	request, _ := http.NewRequest("GET", "/api/v2/files/main.min.css", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "2 main.min css" {
+		t.Fail()
+	}
+}
+
+func TestHandleAddsPathsWithAndWithoutOptionalParts(t *testing.T) {
+	router := New()
+	router.HandleFunc("GET", "/posts[/:page|int[/:sort]]", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		response.Write([]byte(fmt.Sprint(len(params),
+			request.PathValue("page"), request.PathValue("sort"))))
+	})
+
+	for path, body := range map[string]string{"/posts": "0",
+		"/posts/2": "12", "/posts/2/date": "22date"} {
+
+		request, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Body.String() != body {
+			t.Error(path)
+		}
+	}
+}
+
+func TestTryHandleOfOptionalPartsReportsMalformedPathBeforeAdding(
+	t *testing.T) {
+
+	router := New()
+	err := router.TryHandle("GET", "/posts[/:page|unknown]", emptyHandler)
+	if !errors.Is(err, ErrInvalidPath) ||
+		err.(*RouteError).Path != "/posts[/:page|unknown]" {
+
+		t.Fail()
+	}
+	if router.tree.Load().find("/posts") != nil {
+		t.Fail()
+	}
+}
+
+func TestTryHandleOfOptionalPartsLeavesRouterUnchangedOnError(
+	t *testing.T) {
+
+	router := New()
+	router.Handle("GET", "/posts", emptyHandler)
+	err := router.TryHandle("GET", "/posts/:page?", emptyHandler)
+	if !errors.Is(err, ErrDuplicateRoute) || len(router.Routes()) != 1 ||
+		router.tree.Load().find("/posts/:page") != nil {
+
+		t.Fail()
+	}
+	// the expanded paths can conflict with each other too
+	err = router.TryHandle("POST", "/[:a/]:b", emptyHandler)
+	if !errors.Is(err, ErrParamConflict) || len(router.Routes()) != 1 ||
+		len(router.methods) != 1 || router.maxParams != 0 {
+
+		t.Fail()
+	}
+	if router.TryHandle("GET", "/posts[/:page]", emptyHandler) == nil {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "/posts/2", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPSetsAllowHeaderToMethodsOfAllMatchingRoutes(
+	t *testing.T) {
+
+	router := New()
+	router.MethodNotAllowed = emptyHandler
+	router.Handle("GET", "/users/:id", emptyHandler)
+	router.Handle("POST", "/users/new", emptyHandler)
+	router.Handle("PUT", "/users/:id|int", emptyHandler)
+	router.Handle("DELETE", "/other", emptyHandler)
+
+	request, _ := http.NewRequest("DELETE", "/users/new", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("DELETE", "/users/1", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "GET, PUT, OPTIONS" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPServesParamRouteIfStaticRouteLacksMethod(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("POST", "/users/new", failHandler)
+	router.Handle("GET", "/users/:id", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/users/new", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestHostRoutesRequestsToRouterOfHost(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/path", failHandler)
+	api := router.Host("api.example.com")
+	api.Handle("GET", "/path", emptyHandler)
+	if router.Host("api.example.com") != api || api == router {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "http://API.example.com:8080/path",
+		nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestHostIgnoresPortOfHost(t *testing.T) {
+	router := New()
+	api := router.Host("api.example.com:8080")
+	api.Handle("GET", "/path", emptyHandler)
+	if router.Host("api.example.com") != api || api.hostParams != 0 {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "http://api.example.com/path", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestHostRoutesUnmatchedHostsToDefaultRouter(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/path", emptyHandler)
+	router.Host("api.example.com").Handle("GET", "/path", failHandler)
+
+	request, _ := http.NewRequest("GET", "http://www.example.com/path", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "http://api.example.com/other", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+}
+
+func TestHostPutsParamsOfHostBeforeParamsOfPath(t *testing.T) {
+	router := New()
+	router.Host(":tenant.example.com").HandleFunc("GET", "/users/:id", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		params := ParamsFromContext(request.Context())
+		if len(params) != 2 || params[0] != (Param{"tenant", "Acme", nil}) ||
+			params[1] != (Param{"id", "1", nil}) ||
+			request.PathValue("tenant") != "Acme" || cap(params) < 2 {
+
+			t.Fail()
+		}
+	})
+
+	request, _ := http.NewRequest("GET", "http://Acme.example.com/users/1",
+		nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestHostRedirectsWithoutParamsOfHost(t *testing.T) {
+	router := New()
+	tenant := router.Host(":tenant.example.com")
+	tenant.RedirectFixedCase = true
+	tenant.Handle("GET", "/users/:id", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "http://acme.example.com/USERS/1",
+		nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 || response.Header().Get("Location") != "/users/1" {
+		t.Fail()
+	}
+}
+
+func TestHostCopiesSettingsOfRouter(t *testing.T) {
+	router := New()
+	router.Use(tagMiddleware("a"))
+	router.NotFound = emptyHandler
+	router.HandleHEAD = true
+	router.WrapFallbacks = false
+	tenant := router.Host(":tenant.example.com")
+	if tenant.NotFound != emptyHandler || !tenant.HandleHEAD ||
+		tenant.WrapFallbacks || len(tenant.middleware) != 1 {
+
+		t.Fail()
+	}
+	tenant.Handle("GET", "/", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "http://a.example.com/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "a" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRecoversPanicOfHostWithPanicHandlerOfRouter(
+	t *testing.T) {
+
+	router := New()
+	tenant := router.Host(":tenant.example.com")
+	tenant.HandleFunc("GET", "/", func(response http.ResponseWriter,
+		request *http.Request) {
+
+		panic("oops")
+	})
+	var recovered interface{}
+	router.PanicHandler = func(response http.ResponseWriter,
+		request *http.Request, value interface{}) {
+
+		recovered = value
+	}
+
+	request, _ := http.NewRequest("GET", "http://a.example.com/", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if recovered != "oops" || response.Code != 500 {
+		t.Fail()
+	}
+}
+
+func TestHostPanicsIfHostIsMalformed(t *testing.T) {
+	for _, host := range []string{"example.com/path", ":.example.com",
+		"a.*rest.com"} {
+
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Error(host)
+				}
+			}()
+			New().Host(host)
+		}()
+	}
+}
+
+func TestServeHTTPRoutesByMatchersOfRoutes(t *testing.T) {
+	router := New()
+	for _, version := range []string{"1", "2"} {
+		version := version
+		router.HandleFunc("GET", "/users", func(
+			response http.ResponseWriter, request *http.Request) {
+
+			response.Write([]byte("v" + version))
+		}, Header("X-API-Version", version))
+	}
+	router.HandleFunc("GET", "/users", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte("csv"))
+	}, QueryValue("format", "csv"))
+
+	request, _ := http.NewRequest("GET", "/users", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/users?format=csv", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "csv" {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/users?format=csv", nil)
+	request.Header.Set("X-API-Version", "2")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "v2" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPTriesOtherRoutesIfMatchersAreNotSatisfied(
+	t *testing.T) {
+
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/users/new", failHandler, Header("X", "1"))
+	router.HandleFunc("GET", "/users/:id", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte(ParamsFromContext(request.Context()).Get("id")))
+	})
+
+	request, _ := http.NewRequest("GET", "/users/new", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 || response.Body.String() != "new" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPUsesMethodNotAllowedIfNoMatcherIsSatisfied(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.MethodNotAllowed = emptyHandler
+	router.Handle("POST", "/users", failHandler, ContentType("text/csv"))
+	router.Handle("PUT", "/users", emptyHandler)
+
+	request, _ := http.NewRequest("POST", "/users", nil)
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "PUT, OPTIONS" {
+		t.Fail()
+	}
+}
+
+func TestMergeKeepsMatchersOfRoutes(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	other := New()
+	other.Handle("GET", "/users", failHandler, Query("a"))
+	router := New()
+	router.Handle("GET", "/api/users", emptyHandler)
+	if router.Merge("/api", other) != nil {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "/api/users", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPNegotiatesHandlerByAcceptHeader(t *testing.T) {
+	router := New()
+	for _, mediaType := range []string{"application/json", "text/html"} {
+		mediaType := mediaType
+		router.HandleFunc("GET", "/users", func(
+			response http.ResponseWriter, request *http.Request) {
+
+			response.Write([]byte(mediaType))
+		}, Produces(mediaType))
+	}
+
+	request, _ := http.NewRequest("GET", "/users", nil)
+	request.Header.Set("Accept", "text/html, application/json;q=0.9")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "text/html" {
+		t.Fail()
+	}
+
+	request.Header.Set("Accept", "text/*;q=0.5, application/*")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "application/json" {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPRespondsNotAcceptableIfNoMediaTypeIsAccepted(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/users", failHandler, Produces("application/json"))
+
+	request, _ := http.NewRequest("GET", "/users", nil)
+	request.Header.Set("Accept", "text/html")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusNotAcceptable {
+		t.Fail()
+	}
+
+	router.NotAcceptable = emptyHandler
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 {
+		t.Fail()
+	}
+}
+
+func TestServeHTTPTriesOtherRoutesBeforeRespondingNotAcceptable(
+	t *testing.T) {
+
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Handle("GET", "/a/new", failHandler, Produces("application/json"))
+	router.HandleFunc("GET", "/a/:id", func(
+		response http.ResponseWriter, request *http.Request) {
+
+		response.Write([]byte(ParamsFromContext(request.Context()).Get("id")))
+	}, Produces("text/html"))
+
+	request, _ := http.NewRequest("GET", "/a/new", nil)
+	request.Header.Set("Accept", "text/html")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 200 || response.Body.String() != "new" {
+		t.Fail()
+	}
+
+	// the first route with handlers for the method decides the response
+	request.Header.Set("Accept", "image/png")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusNotAcceptable {
+		t.Fail()
+	}
+}
+
+func TestHandleOfSameMediaTypesTwicePanics(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users", emptyHandler, Produces("text/html"))
+	router.Handle("GET", "/users", emptyHandler, Produces("text/plain"))
+	defer func() {
+		if recover() == nil {
+			t.Fail()
+		}
+	}()
+	router.Handle("GET", "/users", emptyHandler, Produces("text/html"))
+}
+
+func TestMergeKeepsMediaTypesOfRoutes(t *testing.T) {
+	other := New()
+	other.Handle("GET", "/users", emptyHandler, Produces("application/json"))
+	router := New()
+	router.Handle("GET", "/api/users", emptyHandler, Produces("text/html"))
+	if router.Merge("/api", other) != nil {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "/api/users", nil)
+	request.Header.Set("Accept", "image/png")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusNotAcceptable {
+		t.Fail()
+	}
+}
+
+func TestUseWrapsHandlersOfRoutesAddedAfterwards(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/before", emptyHandler)
+	router.Use(tagMiddleware("a"), tagMiddleware("b"))
+	router.Handle("GET", "/after", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/after", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "ab" {
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/before", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "" {
+		t.Fail()
+	}
+}
+
+func TestMiddlewareOfRouterWrapsMiddlewareOfGroupAndRoute(t *testing.T) {
+	router := New()
+	router.Use(tagMiddleware("r"))
+	group := router.Group("/admin", tagMiddleware("g"))
+	group.Handle("GET", "/users", emptyHandler, tagMiddleware("h"),
+		Query("a"))
+
+	request, _ := http.NewRequest("GET", "/admin/users?a", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "rgh" {
+		t.Fail()
+	}
+}
+
+func TestMiddlewareWrapsFallbackHandlers(t *testing.T) {
+	router := New()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter,
+			request *http.Request) {
+
+			response.Header().Set("X-Tag", "a")
+			next.ServeHTTP(response, request)
+		})
+	})
+	router.Handle("GET", "/users", emptyHandler, Produces("text/html"))
+	router.Handle("POST", "/users", emptyHandler)
+
+	request, _ := http.NewRequest("GET", "/missing", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 || response.Header().Get("X-Tag") != "a" {
+		t.Fail()
+	}
+
+	router.MethodNotAllowed = emptyHandler
+	request, _ = http.NewRequest("PUT", "/users", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("X-Tag") != "a" ||
+		response.Header().Get("Allow") != "GET, POST, OPTIONS" {
+
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/users", nil)
+	request.Header.Set("Accept", "application/json")
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != http.StatusNotAcceptable ||
+		response.Header().Get("X-Tag") != "a" {
+
+		t.Fail()
+	}
+}
+
+func TestMiddlewareWrapsAutomaticOPTIONSAndRedirects(t *testing.T) {
+	router := New()
+	router.RedirectTrailingSlash = true
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter,
+			request *http.Request) {
+
+			response.Header().Set("Access-Control-Allow-Origin", "*")
+			next.ServeHTTP(response, request)
+		})
+	})
+	router.Handle("GET", "/users", emptyHandler)
+
+	request, _ := http.NewRequest("OPTIONS", "/users", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 204 || response.Header().Get("Allow") == "" ||
+		response.Header().Get("Access-Control-Allow-Origin") != "*" {
+
+		t.Fail()
+	}
+
+	request, _ = http.NewRequest("GET", "/users/?a", nil)
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 301 ||
+		response.Header().Get("Location") != "/users?a" ||
+		response.Header().Get("Access-Control-Allow-Origin") != "*" {
+
+		t.Fail()
+	}
+}
+
+func TestMiddlewareDoesntWrapFallbackHandlersWithoutWrapFallbacks(
+	t *testing.T) {
+
+	router := New()
+	router.Use(tagMiddleware("a"))
+	router.WrapFallbacks = false
+	router.NotFound = emptyHandler
+
+	request, _ := http.NewRequest("GET", "/missing", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "" {
+		t.Fail()
+	}
+}
+
+func TestRemoveRemovesHandlersAndNamesOfRoute(t *testing.T) {
+	router := New()
+	router.MethodNotAllowed = emptyHandler
+	router.Handle("GET", "/users/:id", emptyHandler).Name("user")
+	router.Handle("GET", "/users/:id", emptyHandler, Query("a"))
+	router.Handle("PUT", "/users/:id", emptyHandler)
+	if router.Remove("GET", "/users/:id") != nil {
+		t.Fail()
+	}
+	if _, err := router.URL("user", "id", "1"); !errors.Is(err,
+		ErrUnknownRoute) {
+
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "/users/1?a", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Header().Get("Allow") != "PUT, OPTIONS" {
+		t.Fail()
+	}
+
+	if router.Remove("PUT", "/users/:id") != nil {
+		t.Fail()
+	}
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Code != 404 || len(router.Routes()) != 0 ||
+		len(router.tree.Load().next) != 0 {
+
+		t.Fail()
+	}
+}
+
+func TestRemoveOfPathWithOptionalPartsRemovesAllPaths(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/posts[/:page]", emptyHandler)
+	router.Handle("GET", "/posts/new", emptyHandler)
+	if router.Remove("GET", "/posts[/:page]") != nil {
+		t.Fail()
+	}
+	routes := router.Routes()
+	if len(routes) != 1 || routes[0].Pattern != "/posts/new" ||
+		router.tree.Load().next[0].path != "posts/new" {
+
+		t.Fail()
+	}
+}
+
+func TestRemoveOfUnknownRouteReturnsErrorAndChangesNothing(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/posts", emptyHandler)
+	err := router.Remove("GET", "/posts[/:page]")
+	if !errors.Is(err, ErrUnknownRoute) || len(router.Routes()) != 1 {
+		t.Fail()
+	}
+	if !errors.Is(router.Remove("POST", "/posts"), ErrUnknownRoute) ||
+		!errors.Is(router.Remove("GET", "posts"), ErrInvalidPath) {
+
+		t.Fail()
+	}
+}
+
+func TestRemoveAndReplaceWhileServingRequests(t *testing.T) {
+	router := New()
+	router.Handle("GET", "/users/:id", emptyHandler)
+	for i := 0; i < 100; i++ {
+		router.Handle("GET", "/posts/"+strconv.Itoa(i), emptyHandler).Name(
+			"post" + strconv.Itoa(i))
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			path := "/posts/" + strconv.Itoa(i)
+			router.Replace("GET", path, differentEmptyHandler)
+			router.Remove("GET", path)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		request, _ := http.NewRequest("GET", "/users/"+strconv.Itoa(i), nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		if response.Code != 200 {
+			t.Fail()
+		}
+		router.URL("post"+strconv.Itoa(i))
+		request, _ = http.NewRequest("GET", "/posts/"+strconv.Itoa(i), nil)
+		router.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	wg.Wait()
+	if len(router.Routes()) != 1 {
+		t.Fail()
+	}
+}
+
+func TestReplaceReplacesHandlersOfRoute(t *testing.T) {
+	failHandler := &failHandlerStruct{t}
+	router := New()
+	router.Use(tagMiddleware("a"))
+	router.Handle("GET", "/users/:id", failHandler).Name("user")
+	router.Handle("GET", "/users/:id", failHandler, Query("a"))
+	err := router.Replace("GET", "/users/:id", emptyHandler)
+	if err != nil {
+		t.Fail()
+	}
+
+	request, _ := http.NewRequest("GET", "/users/1?a", nil)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	if response.Body.String() != "a" {
+		t.Fail()
+	}
+	if url, _ := router.URL("user", "id", "1"); url != "/users/1" {
+		t.Fail()
+	}
+	if !errors.Is(router.Replace("POST", "/users/:id", emptyHandler),
+		ErrUnknownRoute) {
+
+		t.Fail()
+	}
+}